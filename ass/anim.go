@@ -0,0 +1,158 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "sort"
+         "strings"
+         "encoding/json"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Superinterface of animated image assets. Their Render() renders the first frame.
+type AnimationAsset interface{
+  ImageAsset
+  // Returns the number of frames.
+  Frames() int
+  // Renders frame n (counting from 0) with the given width*height into an RGBA array.
+  RenderFrame(n, width, height int) ([]uint32,error)
+}
+
+// Display duration of frames without "duration" metadata, in milliseconds.
+var DefaultFrameDuration = 100
+
+// An animation made from a sequence of image assets.
+type Animation struct {
+  // The frames in display order.
+  FrameAssets []ImageAsset
+  
+  // The display duration of each frame in milliseconds.
+  Durations []int
+  
+  // How the animation is played: "loop" (repeat from the first frame), "once"
+  // (stop at the last frame) or "pingpong" (alternate forward and backward).
+  LoopMode string
+  
+  // The number of times the animation is played. 0 means forever.
+  LoopCount int
+  
+  // Metadata in JSON format. The metadata of the first frame plus "frames" (the
+  // number of frames), "durations" (Durations), "totalduration" (the sum of all
+  // durations), "loop" (LoopMode) and "loopcount" (LoopCount).
+  MetaJSON []byte
+}
+
+// An asset that is a frame of an animation.
+type animFrame struct {
+  // The number of the frame, e.g. 2 for "run2".
+  num int
+  asset Asset
+  // The metadata the asset was created from. "description" may contain "duration"
+  // and "loop".
+  metadata map[string]string
+}
+
+// Returns an Animation made from frames (sorted by number). If there is only 1 frame,
+// or the frames are not all ImageAssets, no animation is created and the last frame
+// is returned instead (i.e. the last frame wins as with other assets of the same id).
+// pth is the path of the main asset. It is used only in error log messages.
+func newAnimation(pth string, frames []animFrame) Asset {
+  sort.SliceStable(frames, func(i, j int) bool { return frames[i].num < frames[j].num })
+  anim := &Animation{LoopMode:"loop"}
+  for _, f := range frames {
+    im, ok := f.asset.(ImageAsset)
+    if !ok || len(frames) == 1 { return frames[len(frames)-1].asset }
+    
+    var meta map[string]interface{}
+    im.Meta(&meta)
+    duration, ok := meta["duration"].(float64)
+    if !ok { duration = float64(DefaultFrameDuration) }
+    if mode, ok := meta["loop"].(string); ok {
+      anim.LoopMode = mode
+    }
+    anim.FrameAssets = append(anim.FrameAssets, im)
+    anim.Durations = append(anim.Durations, int(duration+0.5))
+  }
+  
+  id := strings.TrimRight(frames[0].metadata["id"], "0123456789")
+  if anim.LoopMode == "once" { anim.LoopCount = 1 }
+  anim.MetaJSON = animationMeta(pth+" => rect "+id, anim.FrameAssets[0], anim.Durations, anim.LoopMode, map[string]interface{}{"loopcount":anim.LoopCount})
+  if anim.MetaJSON == nil { return nil }
+  return anim
+}
+
+// Returns the JSON metadata for an animation as described for Animation.MetaJSON,
+// with the additional entries from extra.
+func animationMeta(errorlabel string, first ImageAsset, durations []int, mode string, extra map[string]interface{}) []byte {
+  if mode != "loop" && mode != "once" && mode != "pingpong" {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Unknown loop mode \"%v\"",errorlabel,mode))
+  }
+  
+  meta := map[string]interface{}{}
+  first.Meta(&meta)
+  delete(meta, "duration")
+  total := 0
+  for _, d := range durations { total += d }
+  meta["frames"] = len(durations)
+  meta["durations"] = durations
+  meta["totalduration"] = total
+  meta["loop"] = mode
+  for k, v := range extra { meta[k] = v }
+  js, err := json.Marshal(meta)
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: JSON conversion error: %v",errorlabel,err))
+    return nil
+  }
+  return js
+}
+
+func (a *Animation) Meta(target interface{}) error {
+  return json.Unmarshal(a.MetaJSON, target)
+}
+
+func (a *Animation) metaJSON() *[]byte {
+  return &a.MetaJSON
+}
+
+// Returns the part r of the first frame (see sliceable), which Render() renders.
+func (a *Animation) slice(r sdl.Rect) ImageAsset {
+  if len(a.FrameAssets) == 0 { return nil }
+  s, ok := a.FrameAssets[0].(sliceable)
+  if !ok { return nil }
+  return s.slice(r)
+}
+
+func (a *Animation) Render(width,height int) ([]uint32,error) {
+  return a.RenderFrame(0, width, height)
+}
+
+func (a *Animation) Frames() int {
+  return len(a.FrameAssets)
+}
+
+func (a *Animation) RenderFrame(n, width, height int) ([]uint32,error) {
+  if n < 0 || n >= len(a.FrameAssets) { return nil, ErrFrame }
+  return a.FrameAssets[n].Render(width, height)
+}
@@ -0,0 +1,276 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "math"
+         "bytes"
+         "image"
+         "image/gif"
+         "image/png"
+         "image/draw"
+         "hash/crc32"
+         "encoding/binary"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Collects the fully composed frames of an animated GIF or APNG.
+type frameCollector struct {
+  width, height int
+  // all frames stacked vertically, in the format of RasterAsset.Pixels
+  pixels []uint32
+  // durations in milliseconds
+  durations []int
+}
+
+// Appends the current state of canvas as a frame with the given duration in
+// milliseconds. Durations of 10ms or less are replaced with DefaultFrameDuration
+// (like web browsers do).
+func (fc *frameCollector) add(canvas *image.RGBA, duration int) {
+  pixels, _ := toARGB(canvas)
+  fc.pixels = append(fc.pixels, pixels...)
+  if duration <= 10 { duration = DefaultFrameDuration }
+  fc.durations = append(fc.durations, duration)
+}
+
+// Returns an Animation whose frames are RasterAssets that share the collected pixels.
+// loopcount is the number of times the animation is played, 0 means forever.
+// If there is only 1 frame, a RasterAsset is returned instead.
+func (fc *frameCollector) animation(pth string, loopcount int) Asset {
+  anim := &Animation{Durations:fc.durations, LoopMode:"loop", LoopCount:loopcount}
+  if loopcount == 1 { anim.LoopMode = "once" }
+  for i := range fc.durations {
+    box := sdl.Rect{0, int32(i*fc.height), int32(fc.width), int32(fc.height)}
+    frame := newRasterAsset(fmt.Sprintf("%v => frame %v",pth,i), fc.pixels, fc.width, &box, map[string]string{"x":"0","y":"0"})
+    if frame == nil { return nil }
+    if len(fc.durations) == 1 { return frame }
+    anim.FrameAssets = append(anim.FrameAssets, frame)
+  }
+  if len(anim.FrameAssets) == 0 {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: No frames",pth))
+    return nil
+  }
+  anim.MetaJSON = animationMeta(pth, anim.FrameAssets[0], anim.Durations, anim.LoopMode, map[string]interface{}{"loopcount":loopcount})
+  if anim.MetaJSON == nil { return nil }
+  return anim
+}
+
+// Adds a GIF image stored in data to the database with path pth. If the GIF is
+// animated, an Animation is added. Errors are appended to ShitLog.
+func addGIF(pth string, data []byte) {
+  id := assetID(pth)
+  if id == nil { return }
+  
+  g, err := gif.DecodeAll(bytes.NewReader(data))
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",pth,err))
+    return
+  }
+  
+  fc := &frameCollector{width:g.Config.Width, height:g.Config.Height}
+  canvas := image.NewRGBA(image.Rect(0,0,fc.width,fc.height))
+  for i, frame := range g.Image {
+    var previous *image.RGBA
+    if g.Disposal[i] == gif.DisposalPrevious {
+      previous = image.NewRGBA(canvas.Rect)
+      copy(previous.Pix, canvas.Pix)
+    }
+    
+    draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+    fc.add(canvas, g.Delay[i]*10)
+    
+    switch g.Disposal[i] {
+      case gif.DisposalBackground: // like browsers, we use transparency instead of the background color
+        draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+      case gif.DisposalPrevious:
+        canvas = previous
+    }
+  }
+  
+  // GIF's loop count is the number of repetitions after the first time (-1 for none)
+  loopcount := g.LoopCount
+  if loopcount < 0 {
+    loopcount = 1
+  } else if loopcount > 0 {
+    loopcount++
+  }
+  
+  makePile(id).put(fc.animation(pth, loopcount), "")
+}
+
+// Returns true if data is a PNG file with an acTL chunk before the image data.
+func isAPNG(data []byte) bool {
+  if len(data) < 8 || string(data[0:8]) != "\x89PNG\r\n\x1a\n" { return false }
+  for chunk := data[8:]; len(chunk) >= 8; {
+    size := int(binary.BigEndian.Uint32(chunk[0:4]))
+    switch string(chunk[4:8]) {
+      case "acTL": return true
+      case "IDAT": return false
+    }
+    if size+12 > len(chunk) { return false }
+    chunk = chunk[size+12:]
+  }
+  return false
+}
+
+// Appends a PNG chunk of the given type and contents to png.
+func appendPNGChunk(png []byte, typ string, contents ...[]byte) []byte {
+  size := 0
+  for _, c := range contents { size += len(c) }
+  png = binary.BigEndian.AppendUint32(png, uint32(size))
+  start := len(png)
+  png = append(png, typ...)
+  for _, c := range contents { png = append(png, c...) }
+  return binary.BigEndian.AppendUint32(png, crc32.ChecksumIEEE(png[start:]))
+}
+
+// The maximum number of pixels of an APNG canvas. Larger APNGs are rejected, so that
+// a corrupt IHDR chunk cannot make addAPNG() allocate huge amounts of memory.
+const maxAPNGPixels = 1<<26
+
+// The frame control information from an APNG fcTL chunk.
+type apngFrame struct {
+  width, height, x, y int
+  // in milliseconds
+  duration int
+  dispose, blend byte
+  // IDAT or fdAT payloads
+  data [][]byte
+}
+
+// Adds an animated PNG (see isAPNG()) stored in data to the database with path pth.
+// Errors are appended to ShitLog.
+func addAPNG(pth string, data []byte) {
+  id := assetID(pth)
+  if id == nil { return }
+  
+  var ihdr []byte
+  // ancillary chunks (e.g. PLTE, tRNS) that every frame needs
+  var common []byte
+  var frames []*apngFrame
+  var current *apngFrame
+  loopcount := 0
+  
+  for chunk := data[8:]; len(chunk) >= 12; {
+    size := int(binary.BigEndian.Uint32(chunk[0:4]))
+    if size+12 > len(chunk) {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v: Truncated PNG chunk",pth))
+      return
+    }
+    typ := string(chunk[4:8])
+    body := chunk[8:8+size]
+    switch typ {
+      case "IHDR":
+        ihdr = body
+      case "acTL":
+        if size >= 8 { loopcount = int(binary.BigEndian.Uint32(body[4:8])) }
+      case "fcTL":
+        if size < 26 {
+          ShitLog = append(ShitLog, fmt.Sprintf("%v: Illegal fcTL chunk",pth))
+          return
+        }
+        num := int(binary.BigEndian.Uint16(body[20:22]))
+        den := int(binary.BigEndian.Uint16(body[22:24]))
+        if den == 0 { den = 100 }
+        current = &apngFrame{
+          width:int(binary.BigEndian.Uint32(body[4:8])), height:int(binary.BigEndian.Uint32(body[8:12])),
+          x:int(binary.BigEndian.Uint32(body[12:16])), y:int(binary.BigEndian.Uint32(body[16:20])),
+          duration:num*1000/den, dispose:body[24], blend:body[25],
+        }
+        frames = append(frames, current)
+      case "IDAT":
+        // The default image is only part of the animation if an fcTL chunk precedes it.
+        if current != nil { current.data = append(current.data, body) }
+      case "fdAT":
+        if current != nil && size >= 4 { current.data = append(current.data, body[4:]) }
+      case "IEND":
+      default:
+        if current == nil { common = appendPNGChunk(common, typ, body) }
+    }
+    chunk = chunk[size+12:]
+  }
+  
+  if len(ihdr) < 13 {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Missing IHDR",pth))
+    return
+  }
+  
+  // PNG limits width and height to 2^31-1
+  width, height := int64(binary.BigEndian.Uint32(ihdr[0:4])), int64(binary.BigEndian.Uint32(ihdr[4:8]))
+  if width <= 0 || height <= 0 || width > math.MaxInt32 || height > math.MaxInt32 {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Illegal dimensions %vx%v",pth,width,height))
+    return
+  }
+  if width*height > maxAPNGPixels {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Dimensions %vx%v too large",pth,width,height))
+    return
+  }
+  for i, f := range frames {
+    if f.width <= 0 || f.height <= 0 || f.x < 0 || f.y < 0 || int64(f.x)+int64(f.width) > width || int64(f.y)+int64(f.height) > height {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => frame %v: Frame %vx%v at %v,%v outside of %vx%v canvas",pth,i,f.width,f.height,f.x,f.y,width,height))
+      return
+    }
+  }
+  
+  fc := &frameCollector{width:int(width), height:int(height)}
+  canvas := image.NewRGBA(image.Rect(0,0,fc.width,fc.height))
+  for i, f := range frames {
+    // build a PNG file for the frame
+    frameihdr := make([]byte, len(ihdr))
+    copy(frameihdr, ihdr)
+    binary.BigEndian.PutUint32(frameihdr[0:4], uint32(f.width))
+    binary.BigEndian.PutUint32(frameihdr[4:8], uint32(f.height))
+    framepng := appendPNGChunk([]byte("\x89PNG\r\n\x1a\n"), "IHDR", frameihdr)
+    framepng = append(framepng, common...)
+    framepng = appendPNGChunk(framepng, "IDAT", f.data...)
+    framepng = appendPNGChunk(framepng, "IEND")
+    img, err := png.Decode(bytes.NewReader(framepng))
+    if err != nil {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => frame %v: %v",pth,i,err))
+      return
+    }
+    
+    area := image.Rect(f.x, f.y, f.x+f.width, f.y+f.height)
+    dispose := f.dispose
+    if dispose == 2 && i == 0 { dispose = 1 } // APNG spec: PREVIOUS on the first frame is BACKGROUND
+    var previous *image.RGBA
+    if dispose == 2 {
+      previous = image.NewRGBA(canvas.Rect)
+      copy(previous.Pix, canvas.Pix)
+    }
+    
+    op := draw.Src
+    if f.blend == 1 { op = draw.Over }
+    draw.Draw(canvas, area, img, img.Bounds().Min, op)
+    fc.add(canvas, f.duration)
+    
+    switch dispose {
+      case 1: draw.Draw(canvas, area, image.Transparent, image.Point{}, draw.Src)
+      case 2: canvas = previous
+    }
+  }
+  
+  makePile(id).put(fc.animation(pth, loopcount), "")
+}
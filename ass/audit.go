@@ -0,0 +1,150 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "io"
+         "fmt"
+         "sort"
+         "strings"
+         "encoding/csv"
+         "encoding/json"
+)
+
+// The licensing information of an asset.
+type AuditEntry struct {
+  // The asset path.
+  Path string `json:"path"`
+  // The file the asset was loaded from.
+  File string `json:"file"`
+  // The id of the rectangle (or region) within File, if the asset is not the whole file.
+  Rect string `json:"rect,omitempty"`
+  // The "license" and "creator" metadata.
+  License string `json:"license"`
+  Creator string `json:"creator"`
+}
+
+// The assets with the same license.
+type AuditGroup struct {
+  // "" for the assets without a license.
+  License string `json:"license"`
+  // The distinct creators of the assets, sorted.
+  Creators []string `json:"creators"`
+  Assets []AuditEntry `json:"assets"`
+}
+
+// Returns the licensing information of all assets grouped by license. The groups
+// are sorted by license, except that the group of assets without a license (if
+// any) comes last. The assets in each group are sorted by path.
+// The "license" and "creator" metadata are always inherited (see inheritedMeta()),
+// so sub-assets get the license of their file and files without embedded metadata
+// (e.g. PNGs) can get it from a directory defaults file.
+func Audit() []AuditGroup {
+  groups := map[string]*AuditGroup{}
+  var walk func(p *pile)
+  walk = func(p *pile) {
+    if p.asset != nil {
+      e := AuditEntry{Path:p.path, File:p.file, Rect:p.rect}
+      if meta, err := inheritedMeta(p.path, p.asset); err == nil {
+        e.License, _ = meta["license"].(string)
+        e.Creator, _ = meta["creator"].(string)
+      }
+      g := groups[e.License]
+      if g == nil {
+        g = &AuditGroup{License:e.License, Creators:[]string{}}
+        groups[e.License] = g
+      }
+      g.Assets = append(g.Assets, e)
+    }
+    for _, s := range p.sub { walk(s) }
+  }
+  walk(assets)
+  
+  res := make([]AuditGroup, 0, len(groups))
+  for _, g := range groups {
+    sort.Slice(g.Assets, func(i, j int) bool { return g.Assets[i].Path < g.Assets[j].Path })
+    creators := map[string]bool{}
+    for _, e := range g.Assets {
+      if e.Creator != "" && !creators[e.Creator] {
+        creators[e.Creator] = true
+        g.Creators = append(g.Creators, e.Creator)
+      }
+    }
+    sort.Strings(g.Creators)
+    res = append(res, *g)
+  }
+  sort.Slice(res, func(i, j int) bool {
+    a, b := res[i].License, res[j].License
+    if (a == "") != (b == "") { return b == "" }
+    return a < b
+  })
+  return res
+}
+
+// Writes the report of groups (as returned by Audit()) to w in the given format, which is one of
+// "text" (human readable), "json" (the groups) or "csv" (one line per asset with
+// the columns path, file, rect, license, creator and a flag that is "MISSING LICENSE"
+// for assets without a license).
+func WriteAudit(w io.Writer, groups []AuditGroup, format string) error {
+  switch format {
+    case "json":
+      data, err := json.MarshalIndent(groups, "", "  ")
+      if err != nil { return err }
+      _, err = w.Write(append(data, '\n'))
+      return err
+      
+    case "csv":
+      c := csv.NewWriter(w)
+      c.Write([]string{"path","file","rect","license","creator","flag"})
+      for _, g := range groups {
+        for _, e := range g.Assets {
+          flag := ""
+          if e.License == "" { flag = "MISSING LICENSE" }
+          c.Write([]string{e.Path, e.File, e.Rect, e.License, e.Creator, flag})
+        }
+      }
+      c.Flush()
+      return c.Error()
+      
+    case "text":
+      for _, g := range groups {
+        title := "License: "+g.License
+        if g.License == "" { title = "MISSING LICENSE" }
+        _, err := fmt.Fprintf(w, "%v (%v assets)\n", title, len(g.Assets))
+        if err != nil { return err }
+        if len(g.Creators) > 0 {
+          fmt.Fprintf(w, "  Creators: %v\n", strings.Join(g.Creators, ", "))
+        }
+        for _, e := range g.Assets {
+          source := e.File
+          if e.Rect != "" { source += " => rect "+e.Rect }
+          by := ""
+          if e.Creator != "" { by = " by "+e.Creator }
+          fmt.Fprintf(w, "  %v (%v)%v\n", e.Path, source, by)
+        }
+        fmt.Fprintln(w)
+      }
+      return nil
+  }
+  return fmt.Errorf("unknown audit format \"%v\"", format)
+}
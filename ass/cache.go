@@ -0,0 +1,162 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "os"
+         "fmt"
+         "hash"
+         "path"
+         "strings"
+         "io/ioutil"
+         "crypto/sha256"
+         "encoding/hex"
+         "encoding/binary"
+)
+
+// If not "", Add() stores the assets it creates from each file in this directory
+// and reuses them when a file with the same path and contents is added again,
+// even by a different process. Files whose processing appended to ShitLog are
+// not cached.
+var CacheDir = ""
+
+// If true (and CacheDir is set), Image() and ImageWith() store rendered SVG images in
+// CacheDir and reuse them for the same image source, size and RenderOptions.
+var CacheRenders = false
+
+// Version of the processing done by Add() and the renderers. It is part of all cache
+// keys, so it must be incremented whenever a change makes the results differ.
+const cacheVersion = 1
+
+// A SHA-256 hash identifying cached data.
+type cacheKey [sha256.Size]byte
+
+// The key of the last version of each file (as passed to Add()) that has been added
+// to each overlay.
+var sourceKeys = map[sourceID]cacheKey{}
+
+// Returns the cache key for the source file file with contents data and sidecar
+// (the contents of its ".assets" file). The key also covers the file's metadata
+// sidecars (see applyMetaSidecars()) and the settings that affect Add().
+func sourceKey(file string, data, sidecar []byte) cacheKey {
+  h := sha256.New()
+  fmt.Fprintf(h, "%v %v %v %v %v %v\n", cacheVersion, packVersion, DefaultFilter, DefaultFrameDuration, StreamThreshold, len(file))
+  h.Write([]byte(file))
+  hashBytes(h, data)
+  hashBytes(h, sidecar)
+  for _, ext := range metaSidecarExts {
+    meta, _ := ioutil.ReadFile(file+ext)
+    hashBytes(h, meta)
+  }
+  var key cacheKey
+  h.Sum(key[:0])
+  return key
+}
+
+// Writes the length of b followed by b to h.
+func hashBytes(h hash.Hash, b []byte) {
+  var buf [8]byte
+  binary.LittleEndian.PutUint64(buf[:], uint64(len(b)))
+  h.Write(buf[:])
+  h.Write(b)
+}
+
+// Returns the path of the file in CacheDir for key with the given extension.
+func cacheFile(key cacheKey, ext string) string {
+  return path.Join(CacheDir, hex.EncodeToString(key[:])+ext)
+}
+
+// If CacheDir contains the assets for key, adds them to the database (appending their
+// piles to loaded) and returns true.
+func addCached(key cacheKey) bool {
+  if CacheDir == "" { return false }
+  f, err := os.Open(cacheFile(key, ".pack"))
+  if err != nil { return false }
+  defer f.Close()
+  root, _, _, err := readPack(f, false)
+  if err != nil { return false }
+  mergePile(assets, root)
+  return true
+}
+
+// Stores the assets of the piles in loaded in CacheDir under key.
+// Errors are ignored, because the cache is only an optimization.
+func cacheLoaded(key cacheKey) {
+  if CacheDir == "" { return }
+  root := &pile{sub:map[string]*pile{}}
+  for _, p := range loaded {
+    q := root
+    for _, k := range strings.Split(p.path, "/") {
+      if q.sub[k] == nil { q.sub[k] = &pile{sub:map[string]*pile{}, path:path.Join(q.path, k)} }
+      q = q.sub[k]
+    }
+    q.asset, q.file, q.rect = p.asset, p.file, p.rect
+  }
+  
+  writeCacheFile(cacheFile(key, ".pack"), func(f *os.File) error { return writePack(f, root, false) })
+}
+
+// Creates file via a temporary file in CacheDir, so that other processes never
+// see partially written files. Errors are ignored.
+func writeCacheFile(file string, write func(f *os.File) error) {
+  os.MkdirAll(CacheDir, 0755)
+  f, err := ioutil.TempFile(CacheDir, "tmp")
+  if err != nil { return }
+  err = write(f)
+  if e := f.Close(); err == nil { err = e }
+  if err == nil { err = os.Rename(f.Name(), file) }
+  if err != nil { os.Remove(f.Name()) }
+}
+
+// Returns the key for a rendering of a with the given size and options (and the
+// renderer version) or false if renderings of a are not cached.
+func renderFileKey(a Asset, width, height int, opt *RenderOptions) (cacheKey, bool) {
+  var key cacheKey
+  svg, ok := a.(*SVGAsset)
+  if !CacheRenders || CacheDir == "" || !ok { return key, false }
+  h := sha256.New()
+  fmt.Fprintf(h, "%v %v %v\n", cacheVersion, width, height)
+  hashBytes(h, []byte(rendererVersion()))
+  hashBytes(h, []byte(opt.key()))
+  hashBytes(h, svg.Head)
+  hashBytes(h, svg.ViewBox)
+  hashBytes(h, svg.Body)
+  h.Sum(key[:0])
+  return key, true
+}
+
+// Returns the image with width*height pixels stored in CacheDir for key or nil.
+func cachedRender(key cacheKey, width, height int) []uint32 {
+  data, err := ioutil.ReadFile(cacheFile(key, ".argb"))
+  if err != nil || len(data) != 4*width*height { return nil }
+  img := make([]uint32, width*height)
+  for i := range img { img[i] = binary.LittleEndian.Uint32(data[4*i:]) }
+  return img
+}
+
+// Stores img in CacheDir for key.
+func cacheRender(key cacheKey, img []uint32) {
+  data := make([]byte, 4*len(img))
+  for i, x := range img { binary.LittleEndian.PutUint32(data[4*i:], x) }
+  writeCacheFile(cacheFile(key, ".argb"), func(f *os.File) error { _, err := f.Write(data); return err })
+}
@@ -0,0 +1,273 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "os"
+         "sort"
+         "math"
+)
+
+// Maximum distance (in pixels) between Collision.Outline and the traced boundary
+// of the opaque pixels.
+var OutlineTolerance = 1.0
+
+// Collision data of an image rendered at a certain size.
+type Collision struct {
+  // The size of the rendered image.
+  Width, Height int
+  
+  // Number of words per row of Mask.
+  Stride int
+  
+  // 1 bit per pixel, set for opaque pixels. The pixel (x,y) is bit x%64 of
+  // Mask[y*Stride+x/64]. Padding bits are 0.
+  Mask []uint64
+  
+  // The convex hull of the opaque pixels as x1,y1,x2,y2,... in clockwise order
+  // (with y pointing down). The coordinates are those of pixel corners, i.e.
+  // a single opaque pixel (0,0) has the hull 0,0,1,0,1,1,0,1.
+  Hull []float64
+  
+  // The outer boundary of the largest 8-connected area of opaque pixels, simplified
+  // with OutlineTolerance. Same format as Hull.
+  Outline []float64
+}
+
+// Renders the image asset with the given asset_path with the given width*height
+// (like ImageWith() without options) and returns its collision data. A pixel is
+// opaque if its alpha value is greater than threshold.
+// The result is cached together with the image, so it must not be modified.
+func CollisionData(asset_path string, width, height int, threshold uint8) (*Collision, error) {
+  pil := find(asset_path)
+  if pil == nil { return nil, os.ErrNotExist }
+  
+  key := renderKey{pil.asset, width, height, ""}
+  if c := cachedCollision(key, threshold); c != nil { return c, nil }
+  
+  img, err := ImageWith(asset_path, width, height, nil)
+  if err != nil { return nil, err }
+  
+  c := &Collision{Width:width, Height:height, Stride:(width+63)/64}
+  c.Mask = make([]uint64, c.Stride*height)
+  for y := 0; y < height; y++ {
+    for x := 0; x < width; x++ {
+      if uint8(img[y*width+x]>>24) > threshold {
+        c.Mask[y*c.Stride+x/64] |= 1 << uint(x%64)
+      }
+    }
+  }
+  c.Hull = c.hull()
+  c.Outline = simplifyPolygon(c.trace(), OutlineTolerance)
+  
+  cacheCollision(key, threshold, c)
+  return c, nil
+}
+
+// Returns true if pixel (x,y) is opaque. Pixels outside of the image are not.
+func (c *Collision) Opaque(x, y int) bool {
+  if x < 0 || y < 0 || x >= c.Width || y >= c.Height { return false }
+  return c.Mask[y*c.Stride+x/64] & (1 << uint(x%64)) != 0
+}
+
+// Returns true if an opaque pixel of c overlaps an opaque pixel of other when
+// other's top left corner is placed at (dx,dy) relative to c's.
+func (c *Collision) Overlaps(other *Collision, dx, dy int) bool {
+  for y := 0; y < c.Height; y++ {
+    oy := y-dy
+    if oy < 0 || oy >= other.Height { continue }
+    row := c.Mask[y*c.Stride:(y+1)*c.Stride]
+    orow := other.Mask[oy*other.Stride:(oy+1)*other.Stride]
+    for i := range row {
+      if row[i] & bitsAt(orow, i*64-dx) != 0 { return true }
+    }
+  }
+  return false
+}
+
+// Returns the 64 bits of row starting at bit pos (which may be negative).
+// Bits outside of row are 0.
+func bitsAt(row []uint64, pos int) uint64 {
+  if pos <= -64 { return 0 }
+  if pos < 0 {
+    if len(row) == 0 { return 0 }
+    return row[0] << uint(-pos)
+  }
+  w, s := pos/64, uint(pos%64)
+  var bits uint64
+  if w < len(row) { bits = row[w] >> s }
+  if s > 0 && w+1 < len(row) { bits |= row[w+1] << (64-s) }
+  return bits
+}
+
+// Returns the convex hull of the opaque pixels (see Collision.Hull).
+func (c *Collision) hull() []float64 {
+  // the outer corners of the leftmost and rightmost opaque pixel of each row
+  pts := [][2]float64{}
+  for y := 0; y < c.Height; y++ {
+    left, right := -1, -1
+    for x := 0; x < c.Width; x++ {
+      if c.Opaque(x, y) {
+        if left < 0 { left = x }
+        right = x
+      }
+    }
+    if left >= 0 {
+      fy := float64(y)
+      pts = append(pts, [2]float64{float64(left),fy}, [2]float64{float64(left),fy+1}, [2]float64{float64(right+1),fy}, [2]float64{float64(right+1),fy+1})
+    }
+  }
+  if len(pts) == 0 { return nil }
+  
+  // Andrew's monotone chain
+  sort.Slice(pts, func(i, j int) bool { return pts[i][0] < pts[j][0] || (pts[i][0] == pts[j][0] && pts[i][1] < pts[j][1]) })
+  cross := func(o, a, b [2]float64) float64 { return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0]) }
+  hull := make([][2]float64, 0, 2*len(pts))
+  for _, p := range pts {
+    for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 { hull = hull[0:len(hull)-1] }
+    hull = append(hull, p)
+  }
+  lower := len(hull)+1
+  for i := len(pts)-2; i >= 0; i-- {
+    for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], pts[i]) <= 0 { hull = hull[0:len(hull)-1] }
+    hull = append(hull, pts[i])
+  }
+  hull = hull[0:len(hull)-1] // last point is the first one
+  
+  // The chain is counterclockwise for y pointing up, i.e. clockwise for y pointing down.
+  res := make([]float64, 0, 2*len(hull))
+  for _, p := range hull {
+    res = append(res, p[0], p[1])
+  }
+  return res
+}
+
+// Returns the corners of the outer boundary of the largest 8-connected area of
+// opaque pixels in clockwise order.
+func (c *Collision) trace() []float64 {
+  // label the areas with flood fills
+  label := make([]int, c.Width*c.Height)
+  best, bestsize, beststart := 0, 0, 0
+  stack := []int{}
+  for start := range label {
+    if label[start] != 0 || !c.Opaque(start%c.Width, start/c.Width) { continue }
+    area := start+1 // unique label
+    size := 0
+    label[start] = area
+    stack = append(stack[0:0], start)
+    for len(stack) > 0 {
+      p := stack[len(stack)-1]
+      stack = stack[0:len(stack)-1]
+      size++
+      x, y := p%c.Width, p/c.Width
+      for ny := y-1; ny <= y+1; ny++ {
+        for nx := x-1; nx <= x+1; nx++ {
+          if c.Opaque(nx, ny) && label[ny*c.Width+nx] == 0 {
+            label[ny*c.Width+nx] = area
+            stack = append(stack, ny*c.Width+nx)
+          }
+        }
+      }
+    }
+    if size > bestsize { best, bestsize, beststart = area, size, start }
+  }
+  if bestsize == 0 { return nil }
+  
+  inside := func(x, y int) bool {
+    return x >= 0 && y >= 0 && x < c.Width && y < c.Height && label[y*c.Width+x] == best
+  }
+  
+  // Walk along the pixel edges with the area on the right, starting at the top left
+  // corner of its first pixel in scan order, heading east.
+  // Directions: 0 east, 1 south, 2 west, 3 north
+  dx := [4]int{1, 0, -1, 0}
+  dy := [4]int{0, 1, 0, -1}
+  // offsets of the pixels ahead-left and ahead-right of a corner for each direction
+  lx, ly := [4]int{0, 0, -1, -1}, [4]int{-1, 0, 0, -1}
+  rx, ry := [4]int{0, -1, -1, 0}, [4]int{0, 0, -1, -1}
+  
+  x0, y0 := beststart%c.Width, beststart/c.Width
+  x, y, d := x0, y0, 0
+  corners := []float64{}
+  for {
+    nd := (d+1)%4 // turn right
+    if inside(x+lx[d], y+ly[d]) {
+      nd = (d+3)%4 // turn left
+    } else if inside(x+rx[d], y+ry[d]) {
+      nd = d // straight on
+    }
+    if nd != d || len(corners) == 0 { corners = append(corners, float64(x), float64(y)) }
+    d = nd
+    x, y = x+dx[d], y+dy[d]
+    if x == x0 && y == y0 { break }
+  }
+  return corners
+}
+
+// Simplifies the closed polygon poly (x1,y1,x2,y2,...) with the Douglas-Peucker
+// algorithm so that no point of poly is farther than tolerance from the result.
+func simplifyPolygon(poly []float64, tolerance float64) []float64 {
+  n := len(poly)/2
+  if n <= 3 { return poly }
+  
+  // split the ring at the first point and the point farthest from it
+  far, fardist := 0, -1.0
+  for i := 1; i < n; i++ {
+    dist := math.Hypot(poly[2*i]-poly[0], poly[2*i+1]-poly[1])
+    if dist > fardist { far, fardist = i, dist }
+  }
+  keep := make([]bool, n+1)
+  keep[0], keep[far], keep[n] = true, true, true
+  at := func(i int) (float64, float64) { i %= n; return poly[2*i], poly[2*i+1] }
+  
+  var simplify func(a, b int)
+  simplify = func(a, b int) {
+    ax, ay := at(a)
+    bx, by := at(b)
+    length := math.Hypot(bx-ax, by-ay)
+    maxi, maxdist := -1, tolerance
+    for i := a+1; i < b; i++ {
+      px, py := at(i)
+      var dist float64
+      if length == 0 {
+        dist = math.Hypot(px-ax, py-ay)
+      } else {
+        dist = math.Abs((bx-ax)*(ay-py) - (ax-px)*(by-ay))/length
+      }
+      if dist > maxdist { maxi, maxdist = i, dist }
+    }
+    if maxi >= 0 {
+      keep[maxi] = true
+      simplify(a, maxi)
+      simplify(maxi, b)
+    }
+  }
+  simplify(0, far)
+  simplify(far, n)
+  
+  res := []float64{}
+  for i := 0; i < n; i++ {
+    if keep[i] { res = append(res, poly[2*i], poly[2*i+1]) }
+  }
+  return res
+}
@@ -0,0 +1,285 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "math"
+         "unsafe"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// The position of the speaker a channel is meant for.
+type speaker int
+
+const (
+  spkOther speaker = iota // unknown or unsupported position; dropped when mixing
+  spkMono
+  spkFL  // front left
+  spkFR  // front right
+  spkFC  // front center
+  spkLFE // low frequency effects
+  spkBL  // back left
+  spkBR  // back right
+  spkFLC // front left of center
+  spkFRC // front right of center
+  spkBC  // back center
+  spkSL  // side left
+  spkSR  // side right
+)
+
+// Channel layouts used by SDL (which are the output layouts), indexed by number of channels.
+var sdlLayouts = [][]speaker{nil, {spkMono}, {spkFL,spkFR}, {spkFL,spkFR,spkLFE}, {spkFL,spkFR,spkBL,spkBR},
+  {spkFL,spkFR,spkLFE,spkBL,spkBR}, {spkFL,spkFR,spkFC,spkLFE,spkBL,spkBR}, {spkFL,spkFR,spkFC,spkLFE,spkBC,spkSL,spkSR},
+  {spkFL,spkFR,spkFC,spkLFE,spkBL,spkBR,spkSL,spkSR}}
+
+// Default channel layouts of WAV files without a channel mask, indexed by number of channels.
+var wavLayouts = [][]speaker{nil, {spkMono}, {spkFL,spkFR}, {spkFL,spkFR,spkFC}, {spkFL,spkFR,spkBL,spkBR},
+  {spkFL,spkFR,spkFC,spkBL,spkBR}, {spkFL,spkFR,spkFC,spkLFE,spkBL,spkBR}, {spkFL,spkFR,spkFC,spkLFE,spkBC,spkSL,spkSR},
+  {spkFL,spkFR,spkFC,spkLFE,spkBL,spkBR,spkSL,spkSR}}
+
+// Channel layouts of Vorbis streams, indexed by number of channels.
+var vorbisLayouts = [][]speaker{nil, {spkMono}, {spkFL,spkFR}, {spkFL,spkFC,spkFR}, {spkFL,spkFR,spkBL,spkBR},
+  {spkFL,spkFC,spkFR,spkBL,spkBR}, {spkFL,spkFC,spkFR,spkBL,spkBR,spkLFE}, {spkFL,spkFC,spkFR,spkSL,spkSR,spkBC,spkLFE},
+  {spkFL,spkFC,spkFR,spkSL,spkSR,spkBL,spkBR,spkLFE}}
+
+// Returns layouts[channels] or nil if there is no such entry.
+func layoutFor(layouts [][]speaker, channels int) []speaker {
+  if channels < len(layouts) { return layouts[channels] }
+  return nil
+}
+
+// The speakers in the order of the bits of a WAVE_FORMAT_EXTENSIBLE channel mask.
+var maskSpeakers = []speaker{spkFL,spkFR,spkFC,spkLFE,spkBL,spkBR,spkFLC,spkFRC,spkBC,spkSL,spkSR}
+
+// Returns the layout described by the WAVE_FORMAT_EXTENSIBLE channel mask.
+// If the mask is 0 or does not describe exactly channels speakers, the default layout is returned.
+func maskLayout(mask uint32, channels int) []speaker {
+  layout := []speaker{}
+  for bit := uint(0); bit < 32; bit++ {
+    if mask & (1<<bit) != 0 {
+      if int(bit) < len(maskSpeakers) {
+        layout = append(layout, maskSpeakers[bit])
+      } else {
+        layout = append(layout, spkOther)
+      }
+    }
+  }
+  if len(layout) != channels || (channels == 1 && layout[0] == spkFC) {
+    return layoutFor(wavLayouts, channels)
+  }
+  return layout
+}
+
+// A contribution of an input channel to an output speaker.
+type speakerGain struct {
+  spk speaker
+  gain float32
+}
+
+// Returns how an input channel for speaker s is distributed to the speakers in out.
+func route(s speaker, out map[speaker]bool) []speakerGain {
+  if out[s] { return []speakerGain{{s,1}} }
+  scale := func(gain float32, routes ...[]speakerGain) []speakerGain {
+    res := []speakerGain{}
+    for _, r := range routes {
+      for _, sg := range r { res = append(res, speakerGain{sg.spk, sg.gain*gain}) }
+    }
+    return res
+  }
+  switch s {
+    case spkMono:
+      return scale(1, route(spkFL, out), route(spkFR, out))
+    case spkFL, spkFR: // only missing if out is mono
+      return []speakerGain{{spkMono,0.5}}
+    case spkFC:
+      return scale(0.7071, route(spkFL, out), route(spkFR, out))
+    case spkFLC:
+      return route(spkFL, out)
+    case spkFRC:
+      return route(spkFR, out)
+    case spkSL, spkBL:
+      if s == spkSL && out[spkBL] { return []speakerGain{{spkBL,1}} }
+      if s == spkBL && out[spkSL] { return []speakerGain{{spkSL,1}} }
+      return scale(0.7071, route(spkFL, out))
+    case spkSR, spkBR:
+      if s == spkSR && out[spkBR] { return []speakerGain{{spkBR,1}} }
+      if s == spkBR && out[spkSR] { return []speakerGain{{spkSR,1}} }
+      return scale(0.7071, route(spkFR, out))
+    case spkBC:
+      return scale(0.7071, route(spkBL, out), route(spkBR, out))
+  }
+  return nil // LFE and unknown speakers are dropped
+}
+
+// Converts the interleaved samples data whose channels are laid out as described
+// by layout to outchannels channels in SDL's layout. Channels are up- and down-mixed
+// according to their speaker positions, e.g. a center channel is distributed to
+// front left and right if the output has no center.
+// If layout is nil or there is no known layout for outchannels, channels are mapped
+// 1:1 and missing channels are silent.
+func mixChannels(data []float32, layout []speaker, channels, outchannels int) []float32 {
+  outlayout := layoutFor(sdlLayouts, outchannels)
+  if channels == outchannels && (layout == nil || outlayout == nil || equalLayouts(layout, outlayout)) {
+    return data
+  }
+  
+  // matrix[i*outchannels+o] is the gain of input channel i in output channel o
+  matrix := make([]float32, channels*outchannels)
+  if layout == nil || outlayout == nil {
+    for i := 0; i < channels && i < outchannels; i++ { matrix[i*outchannels+i] = 1 }
+  } else {
+    out := map[speaker]bool{}
+    for _, spk := range outlayout { out[spk] = true }
+    for i, spk := range layout {
+      for _, sg := range route(spk, out) {
+        for o := range outlayout {
+          if outlayout[o] == sg.spk { matrix[i*outchannels+o] += sg.gain }
+        }
+      }
+    }
+  }
+  
+  frames := len(data)/channels
+  res := make([]float32, frames*outchannels)
+  for f := 0; f < frames; f++ {
+    in := data[f*channels:(f+1)*channels]
+    o := res[f*outchannels:(f+1)*outchannels]
+    for i, s := range in {
+      gains := matrix[i*outchannels:(i+1)*outchannels]
+      for c := range o { o[c] += s*gains[c] }
+    }
+  }
+  return res
+}
+
+func equalLayouts(a, b []speaker) bool {
+  if len(a) != len(b) { return false }
+  for i := range a {
+    if a[i] != b[i] { return false }
+  }
+  return true
+}
+
+// Number of zero crossings of the sinc function on each side of the resampling filter.
+const sincZeroCrossings = 16
+
+// Number of precomputed filter values per input sample.
+const sincResolution = 256
+
+// Converts the interleaved samples data with the given number of channels from
+// sample rate freq to outfreq. Uses a Blackman-windowed sinc filter whose cutoff
+// is lowered when downsampling to avoid aliasing.
+func resample(data []float32, channels int, freq, outfreq int) []float32 {
+  if freq == outfreq { return data }
+  frames := len(data)/channels
+  if frames == 0 { return data }
+  outframes := int((int64(frames)*int64(outfreq) + int64(freq) - 1)/int64(freq))
+  
+  table, halfwidth := sincTable(freq, outfreq)
+  out := make([]float32, outframes*channels)
+  for f := 0; f < outframes; f++ {
+    sincFrame(out[f*channels:(f+1)*channels], data, float64(f)*float64(freq)/float64(outfreq), table, halfwidth)
+  }
+  return out
+}
+
+// Returns the filter table for resampling from freq to outfreq and the half
+// width of the filter in input sample frames. table[i] is the filter's value
+// for a distance of i/sincResolution input sample frames.
+func sincTable(freq, outfreq int) (table []float32, halfwidth float64) {
+  // cutoff frequency relative to the input's Nyquist frequency, slightly lowered
+  // to leave room for the filter's transition band
+  cutoff := math.Min(1, float64(outfreq)/float64(freq))*0.95
+  halfwidth = float64(sincZeroCrossings)/cutoff
+  
+  table = make([]float32, int(halfwidth*sincResolution)+2)
+  for i := range table {
+    t := float64(i)/sincResolution
+    if t >= halfwidth { break }
+    x := t/halfwidth
+    window := 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+    sinc := 1.0
+    if t != 0 { sinc = math.Sin(math.Pi*cutoff*t)/(math.Pi*cutoff*t) }
+    table[i] = float32(cutoff*sinc*window)
+  }
+  return
+}
+
+// Computes the output frame at the (fractional) input frame position pos from the
+// interleaved samples data with len(out) channels and stores it in out. Frames outside
+// of data are treated as silence.
+func sincFrame(out []float32, data []float32, pos float64, table []float32, halfwidth float64) {
+  channels := len(out)
+  frames := len(data)/channels
+  lo := int(math.Ceil(pos-halfwidth))
+  if lo < 0 { lo = 0 }
+  hi := int(math.Floor(pos+halfwidth))
+  if hi >= frames { hi = frames-1 }
+  for c := range out { out[c] = 0 }
+  for i := lo; i <= hi; i++ {
+    t := math.Abs(pos-float64(i))*sincResolution
+    idx := int(t)
+    frac := float32(t-float64(idx))
+    w := table[idx] + (table[idx+1]-table[idx])*frac
+    in := data[i*channels:(i+1)*channels]
+    for c, s := range in { out[c] += s*w }
+  }
+}
+
+// Converts the interleaved samples data with the given channel layout and sample rate
+// freq to format and returns the raw native endian bytes.
+func convertSamples(data []float32, layout []speaker, channels, freq int, format SoundFormat) []byte {
+  data = mixChannels(data, layout, channels, format.Channels)
+  data = resample(data, format.Channels, freq, format.Freq)
+  pcm := make([]byte, len(data)*format.frameSize()/format.Channels)
+  putSamples(pcm, data, format.Type)
+  return pcm
+}
+
+// Converts samples to typ and stores the raw native endian bytes in p, which must be large enough.
+func putSamples(p []byte, samples []float32, typ SampleType) {
+  if len(samples) == 0 { return }
+  if typ == SampleFloat32 {
+    copy(unsafe.Slice((*float32)(unsafe.Pointer(&p[0])), len(samples)), samples)
+    return
+  }
+  
+  out := unsafe.Slice((*int16)(unsafe.Pointer(&p[0])), len(samples))
+  for i, s := range samples {
+    out[i] = int16(math.Round(math.Max(-1, math.Min(1, float64(s)))*32767))
+  }
+}
+
+// Returns the SoundFormat that matches spec, which is typically the obtained spec
+// of sdl.OpenAudioDevice(). Returns ErrIllFormat if spec's Format is not
+// AUDIO_S16SYS or AUDIO_F32SYS.
+func SoundFormatFromSpec(spec *sdl.AudioSpec) (SoundFormat, error) {
+  format := SoundFormat{Freq:int(spec.Freq), Channels:int(spec.Channels)}
+  switch spec.Format {
+    case sdl.AUDIO_S16SYS: format.Type = SampleInt16
+    case sdl.AUDIO_F32SYS: format.Type = SampleFloat32
+    default: return format, ErrIllFormat
+  }
+  return format, nil
+}
@@ -23,6 +23,7 @@
 package ass
 
 import "os"
+import "fmt"
 import "io/ioutil"
 import "path"
 import "strings"
@@ -36,8 +37,34 @@ type Asset interface{
 type pile struct {
   asset Asset
   sub map[string]*pile
+  
+  // The asset path of the pile.
+  path string
+  
+  // The file that asset was loaded from and the id of the rectangle (or region)
+  // within the file, if the asset is not the whole file.
+  file, rect string
+  
+  // Metadata from a directory defaults file (see addDefaults()) and that file.
+  defaults map[string]interface{}
+  defaultsFile string
+  
+  // The overlay that provides asset (see AddOverlay()).
+  overlay string
+  
+  // The assets and defaults of all overlays for this pile (as piles without
+  // sub-piles), lowest priority first. The visible ones are copied into the
+  // fields above by update().
+  overlays []*pile
 }
 
+// The file currently being loaded by Add().
+var loadingFile string
+
+// The piles (from the overlays of their piles in the tree) that have received an
+// asset from loadingFile.
+var loaded []*pile
+
 // All Assets are stored in this pile.
 var assets = &pile{sub:map[string]*pile{}}
 
@@ -48,6 +75,13 @@ type ImageAsset interface{
   Render(width,height int) ([]uint32,error)
 }
 
+// Image assets that support RenderOptions.
+type OptionImageAsset interface{
+  ImageAsset
+  // Like Render() but modified by opt. opt may be nil.
+  RenderWith(width,height int, opt *RenderOptions) ([]uint32,error)
+}
+
 // A rectangular part of an SVG image.
 type SVGAsset struct {
   // XML source code up to the location where viewBox and/or width/height
@@ -66,10 +100,44 @@ type SVGAsset struct {
   // Metadata in JSON format. Always includes "x","y","width","height","centerx"
   // and "centery".
   MetaJSON []byte
+  
+  // The top-level Inkscape layers of the SVG file in document order.
+  // Shared by all assets from the same file.
+  Layers []SVGLayer
+  
+  // The <text> and <tspan> elements of the SVG file that have an id.
+  // Shared by all assets from the same file.
+  Texts []SVGText
+}
+
+// A <text> or <tspan> element of an SVG image.
+type SVGText struct {
+  // The element's id.
+  ID string
+  
+  // Body[Start:End] is the element's content.
+  Start, End int
+}
+
+// A top-level Inkscape layer (<g inkscape:groupmode="layer">) of an SVG image.
+type SVGLayer struct {
+  // The inkscape:label of the layer or its id if it has no label.
+  Label string
+  
+  // Body[Start:End] is the layer's <g> element.
+  Start, End int
+  
+  // true if the layer is hidden in the file (style="display:none").
+  Hidden bool
+  
+  // Body[displayStart:displayEnd] is the "display:none" of a Hidden layer.
+  displayStart, displayEnd int
 }
 
 // If pth is a directory, recursively scans it and subdirectories and collects
 // assets found. If pth refers to an asset file, only that one is added.
+// Files that have already been added with the same contents (including their
+// sidecar files) are skipped. See also CacheDir.
 func Add(pth string) error {
   d, err := os.Open(pth)
   if err != nil { return err }
@@ -85,21 +153,108 @@ func Add(pth string) error {
     // Don't hold file open unnecessarily.
     d.Close()
     
+    defaults, err := ioutil.ReadFile(path.Join(pth,".assets"))
+    if err == nil {
+      addDefaults(pth, defaults)
+    } else if !os.IsNotExist(err) {
+      return err
+    }
+    
     for _, fi := range fis {
       err = Add(path.Join(pth,fi.Name()))
       if err != nil { return err }
     }
   } else {
+    file := pth
     pth = strings.ToLower(path.Clean(pth))
-    if path.Ext(pth) == ".svg" {
-      data, err := ioutil.ReadAll(d)
-      if err != nil { return err }
-      addSVG(pth[0:len(pth)-len(".svg")], data)
+    ext := path.Ext(pth)
+    if ext != ".svg" && ext != ".gif" && !isRasterExt(ext) && !isSoundExt(ext) { return nil }
+    data, err := ioutil.ReadAll(d)
+    if err != nil { return err }
+    sidecar, err := readSidecar(file)
+    if err != nil { return err }
+    
+    key := sourceKey(file, data, sidecar)
+    id := sourceID{loadingOverlay, file}
+    if old, ok := sourceKeys[id]; ok && old == key { return nil } // unchanged
+    
+    loadingFile, loaded = file, nil
+    if !addCached(key) {
+      errors := len(ShitLog)
+      pth = pth[0:len(pth)-len(ext)]
+      if ext == ".svg" {
+        addSVG(pth, data)
+      } else if isRasterExt(ext) {
+        addRaster(pth, data, sidecar)
+      } else if ext == ".gif" {
+        addGIF(pth, data)
+      } else {
+        addSound(pth, ext, data, sidecar)
+      }
+      applyMetaSidecars(file, pth, loaded)
+      if len(ShitLog) == errors { cacheLoaded(key) }
     }
+    validate(loaded)
+    sourceKeys[id] = key
   }
   return nil
 }
 
+// Returns the contents of the file file+".assets" or nil if it does not exist.
+func readSidecar(file string) ([]byte, error) {
+  data, err := ioutil.ReadFile(file+".assets")
+  if os.IsNotExist(err) { return nil, nil }
+  return data, err
+}
+
+// Splits pth at "/" and removes trailing digits from each component.
+// Returns nil (after logging to ShitLog) if a component consists only of digits.
+func assetID(pth string) []string {
+  id := strings.Split(pth,"/")
+  if id[0] == "" { id = id[1:] } // in case pth starts with "/"
+  for i := range id {
+    // remove trailing digits
+    id[i] = strings.TrimRight(id[i], "0123456789")
+    if id[i] == "" {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v: All path components must contain at least 1 non-digit character",pth))
+      return nil
+    }
+  }
+  return id
+}
+
+// Returns the pile for the path components id, creating intermediate nodes
+// if necessary.
+func makePile(id []string) *pile {
+  a := assets
+  for _, idpart := range id {
+    aa := a.sub[idpart]
+    if aa == nil {
+      aa = &pile{sub:map[string]*pile{}, path:path.Join(a.path, idpart)}
+      a.sub[idpart] = aa
+    }
+    a = aa
+  }
+  return a
+}
+
+// Stores asset in p for loadingOverlay. If asset is nil, p is left unchanged.
+// rect is the id of the rectangle (or region) within loadingFile that the asset
+// was made from or "" if the asset is the whole file.
+// Within an overlay we do not support multiple assets with the same id. If a new
+// asset comes in with the same id it will just replace the previously stored one.
+func (p *pile) put(asset Asset, rect string) {
+  if asset != nil {
+    loaded = append(loaded, p.provide(asset, loadingFile, rect, nil, ""))
+  }
+}
+
+// Returns a label for p's asset for error messages, e.g. "gfx/hero.svg => rect gun".
+func (p *pile) source() string {
+  if p.rect == "" { return p.file }
+  return p.file+" => rect "+p.rect
+}
+
 // Returns a list (unsorted) of the full paths of all assets with the given path_prefix.
 // If prefix does not end in "/" it is nevertheless assumed. IOW, a path_prefix
 // cannot be a partial name.
@@ -133,10 +288,12 @@ func list(res *[]string, p *pile, prefix []string) {
 
 // Unmarshal's the JSON metadata of the asset with the given asset_path into
 // target.
+// If InheritMeta is true, the metadata is merged with that of the parent assets
+// (see inheritedMeta()).
 func Meta(asset_path string, target interface{}) error {
   pil := find(asset_path)
   if pil == nil { return os.ErrNotExist }
-  return pil.asset.Meta(target)
+  return pil.meta(target)
 }
 
 // Renders the image asset with the given asset_path into an RGBA array
@@ -150,7 +307,107 @@ func Image(asset_path string, width, height int) ([]uint32, error) {
   var imass ImageAsset
   imass, ok := pil.asset.(ImageAsset)
   if !ok { return nil, ErrAssetType }
-  return imass.Render(width,height)
+  
+  key, cached := renderFileKey(pil.asset, width, height, nil)
+  if cached {
+    if img := cachedRender(key, width, height); img != nil { return img, nil }
+  }
+  img, err := imass.Render(width,height)
+  if err == nil && cached { cacheRender(key, img) }
+  return img, err
+}
+
+// Like Image() but modified by opt (e.g. to show/hide layers or replace colors).
+// Options that do not apply to the asset are ignored.
+// The results are kept in a cache (see RenderCacheSize), so repeated calls with
+// the same arguments are cheap.
+func ImageWith(asset_path string, width, height int, opt *RenderOptions) ([]uint32, error) {
+  pil := find(asset_path)
+  if pil == nil { return nil, os.ErrNotExist }
+  imass, ok := pil.asset.(ImageAsset)
+  if !ok { return nil, ErrAssetType }
+  
+  key := renderKey{pil.asset, width, height, opt.key()}
+  if img := cachedImage(key); img != nil { return img, nil }
+  
+  render := func(a ImageAsset, width, height int) ([]uint32,error) {
+    if optass, ok := a.(OptionImageAsset); ok { return optass.RenderWith(width,height,opt) }
+    return a.Render(width,height)
+  }
+  
+  filekey, cached := renderFileKey(pil.asset, width, height, opt)
+  var img []uint32
+  var err error
+  if cached {
+    img = cachedRender(filekey, width, height)
+  }
+  if img == nil {
+    if opt != nil && opt.NineSlice {
+      img, err = renderNineSlice(imass, width, height, render)
+    } else {
+      img, err = render(imass, width, height)
+    }
+    if err != nil { return nil, err }
+    if cached { cacheRender(filekey, img) }
+  }
+  cacheImage(key, img)
+  return img, nil
+}
+
+// Returns the labels of the layers of the SVG image asset with the given asset_path
+// in document order.
+func Layers(asset_path string) ([]string, error) {
+  pil := find(asset_path)
+  if pil == nil { return nil, os.ErrNotExist }
+  svgass, ok := pil.asset.(*SVGAsset)
+  if !ok { return nil, ErrAssetType }
+  labels := make([]string, len(svgass.Layers))
+  for i := range svgass.Layers {
+    labels[i] = svgass.Layers[i].Label
+  }
+  return labels, nil
+}
+
+// Returns the number of frames of the animation asset with the given asset_path.
+func Frames(asset_path string) (int, error) {
+  pil := find(asset_path)
+  if pil == nil { return 0, os.ErrNotExist }
+  anim, ok := pil.asset.(AnimationAsset)
+  if !ok { return 0, ErrAssetType }
+  return anim.Frames(), nil
+}
+
+// Renders frame n (counting from 0) of the animation asset with the given asset_path
+// like Image().
+func Frame(asset_path string, n, width, height int) ([]uint32, error) {
+  pil := find(asset_path)
+  if pil == nil { return nil, os.ErrNotExist }
+  anim, ok := pil.asset.(AnimationAsset)
+  if !ok { return nil, ErrAssetType }
+  return anim.RenderFrame(n, width, height)
+}
+
+// Returns the PCM data of the sound asset with the given asset_path converted to format.
+// The conversion result is cached per format, so the returned slice is shared and
+// must not be modified. Use SoundFormatFromSpec() to get the format for an SDL audio device.
+func Sound(asset_path string, format SoundFormat) ([]byte, error) {
+  pil := find(asset_path)
+  if pil == nil { return nil, os.ErrNotExist }
+  var sndass SoundAsset
+  sndass, ok := pil.asset.(SoundAsset)
+  if !ok { return nil, ErrAssetType }
+  return sndass.Samples(format)
+}
+
+// Returns a SoundStream that reads the sound asset with the given asset_path
+// converted to format. Unlike Sound() this does not decode and convert the whole
+// sound at once, which is preferable for music.
+func Stream(asset_path string, format SoundFormat) (*SoundStream, error) {
+  pil := find(asset_path)
+  if pil == nil { return nil, os.ErrNotExist }
+  stass, ok := pil.asset.(streamable)
+  if !ok { return nil, ErrAssetType }
+  return newSoundStream(stass, format)
 }
 
 // Returns the pile for path pth if it exists AND has an asset. Otherwise returns nil.
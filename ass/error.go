@@ -31,6 +31,23 @@ var ShitLog []string
 var ErrAssetType = errors.New("incorrect asset type")
 // The provided width/height are illegal.
 var ErrIllDimensions = errors.New("illegal image dimensions")
+// The requested frame does not exist.
+var ErrFrame = errors.New("no such frame")
+// RenderOptions refer to a layer that does not exist.
+var ErrLayer = errors.New("no such layer")
+// A color in RenderOptions is not in "#rrggbb" or "#rgb" notation.
+var ErrIllColor = errors.New("illegal color")
+// A CSS custom property in RenderOptions does not start with "--" or its name or
+// value contains illegal characters.
+var ErrIllProperty = errors.New("illegal CSS custom property")
+// A nine-slice rendering was requested for an image without valid "slice" metadata.
+var ErrSlice = errors.New("no valid nine-slice metadata")
+// The requested point does not exist.
+var ErrPoint = errors.New("no such point")
+// The provided SoundFormat is illegal.
+var ErrIllFormat = errors.New("illegal sound format")
+// An asset pack is corrupt or was written by an incompatible version.
+var ErrPack = errors.New("corrupt or unsupported asset pack")
 // An error for which no more specific information is available.
 var ErrUnknown = errors.New("unknown error")
 
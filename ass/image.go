@@ -32,6 +32,7 @@ import "C"
 
 
 import (
+         "bytes"
          "strings"
          "fmt"
          "html"
@@ -56,16 +57,8 @@ func addSVG(pth string, data []byte) {
     }
   }()
 
-  id := strings.Split(pth,"/")
-  if id[0] == "" { id = id[1:] } // in case pth starts with "/"
-  for i := range id {
-    // remove trailing digits
-    id[i] = strings.TrimRight(id[i], "0123456789")
-    if id[i] == "" {
-      ShitLog = append(ShitLog, fmt.Sprintf("%v: All path components must contain at least 1 non-digit character",pth))
-      return
-    }
-  }
+  id := assetID(pth)
+  if id == nil { return }
   
   // We copy from data[in] to data[out]. Because we remove whitespace and certain parts of
   // the image out <= in.
@@ -99,7 +92,36 @@ func addSVG(pth string, data []byte) {
   // Collects the attributes of the most recent start tag.
   attributes := map[string]string{}
   
+  // Collects the attributes of the most recent <g> start tag.
+  gattributes := map[string]string{}
+  
+  // data[display_start:display_end] is the "display:none" within the style attribute
+  // of the most recent <g> start tag. -1 if there is none.
+  display_start, display_end := -1, -1
+  
+  // The id of the most recent <text> or <tspan> start tag.
+  textid := ""
+  
+  // One entry for each currently open <text> or <tspan> element. The index of
+  // its entry in texts or -1 if it has no id.
+  textstack := []int{}
+  
+  // The <text> and <tspan> elements with an id. Start and End are indexes into
+  // the output buffer until they are adjusted to Body at the end.
+  texts := []SVGText{}
+  
+  // data[docstart] is the "<" of the most recent child of the <svg> element.
+  docstart := 0
+  
+  // The source code of the <title>, <desc> and <metadata> children of the <svg> element.
+  docparts := []string{}
+  
+  // The top-level Inkscape layers. Start, End and the display range are indexes into
+  // the output buffer until they are adjusted to Body at the end.
+  layers := []SVGLayer{}
+  
   // Each <rect> element within the <g> with id/label "METADATA" has its attributes appended here.
+  // Circles, ellipses, polygons and paths are appended as points or shapes (see svgMark()).
   // In addition to the element attributes, if the <rect> has a <desc> child, that element's
   // content is stored under the name "description" in the respective map.
   metadata := []map[string]string{}
@@ -141,14 +163,24 @@ func addSVG(pth string, data []byte) {
           }
         }
         endtagname := string(data[etn:out])
-        if endtagname == "desc" {
+        if level == 2 && (endtagname == "title" || endtagname == "desc" || endtagname == "metadata") {
+          docparts = append(docparts, string(data[docstart:out])+">")
+        } else if endtagname == "desc" {
           desc := o
           for data[desc-1] != '>' { desc-- }
           attributes["description"] = html.UnescapeString(string(data[desc:o]))
         } else if in_metadata && endtagname == "rect" {
           metadata = append(metadata,attributes)
+        } else if in_metadata && isMarkTag(endtagname) {
+          if mark := svgMark(pth, endtagname, attributes); mark != nil { metadata = append(metadata,mark) }
+        } else if (endtagname == "text" || endtagname == "tspan") && len(textstack) > 0 {
+          if idx := textstack[len(textstack)-1]; idx >= 0 { texts[idx].End = o }
+          textstack = textstack[0:len(textstack)-1]
         }
         level--
+        if level == 1 && len(layers) > 0 && layers[len(layers)-1].End < 0 { // end of layer
+          layers[len(layers)-1].End = out+1 // +1 for the ">" written below
+        }
         if level == 0 { // end of document
           data[out] = '>'
           out++
@@ -156,6 +188,7 @@ func addSVG(pth string, data []byte) {
         }
         if level == kill_level {
           out = kill_out
+          for len(texts) > 0 && texts[len(texts)-1].Start > kill_out { texts = texts[0:len(texts)-1] }
           kill_level = -1
           in_metadata = false
           continue
@@ -174,10 +207,16 @@ func addSVG(pth string, data []byte) {
           }
         }
         tagname = string(data[tagnamestart+1:out])
-        if tagname == "rect" {
+        if tagname == "rect" || isMarkTag(tagname) {
           attributes = map[string]string{}
+        } else if tagname == "g" {
+          gattributes = map[string]string{}
+          display_start, display_end = -1, -1
+        } else if tagname == "text" || tagname == "tspan" {
+          textid = ""
         }
         level++
+        if level == 2 { docstart = start }
         if c == '>' || c == '/' { // if we have just <foo> or <foo/ we need to process the character after "foo"
           in--                    // so take a step back
           continue
@@ -213,7 +252,15 @@ func addSVG(pth string, data []byte) {
           continue
         }
         
-        if tagname == "rect" { attributes[attrname] = attrval }
+        if tagname == "rect" || isMarkTag(tagname) { attributes[attrname] = attrval }
+        if (tagname == "text" || tagname == "tspan") && attrname == "id" { textid = attrval }
+        if tagname == "g" {
+          gattributes[attrname] = attrval
+          if i := strings.Index(attrval, "display:none"); attrname == "style" && i >= 0 {
+            display_start = attr+i
+            display_end = display_start+len("display:none")
+          }
+        }
         if tagname == "g" && (attrname == "id" || attrname == "label") && // a group with an all-uppercase label or id is eliminated from output
            attrval == strings.ToUpper(attrval) && kill_level < 0 {
           kill_level = level-1
@@ -225,6 +272,8 @@ func addSVG(pth string, data []byte) {
       if c == '/' {  // ..../>
         if in_metadata && tagname == "rect" {
           metadata = append(metadata,attributes)
+        } else if in_metadata && isMarkTag(tagname) {
+          if mark := svgMark(pth, tagname, attributes); mark != nil { metadata = append(metadata,mark) }
         }
         data[out] = c
         out++
@@ -233,6 +282,7 @@ func addSVG(pth string, data []byte) {
         level--
         if level == kill_level {
           out = kill_out
+          for len(texts) > 0 && texts[len(texts)-1].Start > kill_out { texts = texts[0:len(texts)-1] }
           kill_level = -1
           in_metadata = false
           continue
@@ -244,6 +294,19 @@ func addSVG(pth string, data []byte) {
         if level == 1 && svgelement == 0 {
           svgelement = out
         }
+        if level == 2 && tagname == "g" && kill_level < 0 && gattributes["groupmode"] == "layer" {
+          label := gattributes["label"]
+          if label == "" { label = gattributes["id"] }
+          layers = append(layers, SVGLayer{Label:label, Start:start, End:-1, Hidden:display_start >= 0, displayStart:display_start, displayEnd:display_end})
+        }
+        if (tagname == "text" || tagname == "tspan") && data[out-1] != '/' {
+          idx := -1
+          if textid != "" {
+            idx = len(texts)
+            texts = append(texts, SVGText{ID:textid, Start:out+1}) // +1 for the ">" written below
+          }
+          textstack = append(textstack, idx)
+        }
       } else if c == '=' {
         attr := out
         for data[attr-1] >= 'A' || data[attr-1] == '-' { attr-- }
@@ -254,6 +317,18 @@ func addSVG(pth string, data []byte) {
     out++
   }
   
+  // make layer positions relative to Body
+  for i := range layers {
+    layers[i].Start -= svgelement
+    layers[i].End -= svgelement
+    layers[i].displayStart -= svgelement
+    layers[i].displayEnd -= svgelement
+  }
+  for i := range texts {
+    texts[i].Start -= svgelement
+    texts[i].End -= svgelement
+  }
+  
   // make a copy to allow memory to be freed and to insert \n at viewBox insertion point
   dt := make([]byte,out+1)
   copy(dt,data[0:svgelement])
@@ -263,43 +338,58 @@ func addSVG(pth string, data []byte) {
   data = dt 
   
   // find node in tree to insert data, creating intermediate nodes if necessary
-  a := assets
-  for _, idpart := range id {
-    aa := a.sub[idpart]
-    if aa == nil {
-      aa = &pile{sub:map[string]*pile{}}
-      a.sub[idpart] = aa
-    }
-    a = aa
-  }
+  a := makePile(id)
   
   viewBox := toplevelmeta["viewBox"]
   if len(viewBox) < 7 {
     viewBox = fmt.Sprintf("0 0 %v %v",toplevelmeta["width"],toplevelmeta["height"])
   }
   
-  ss := newSVGImageAsset(pth, viewBox, data[0:svgelement], data[svgelement:], map[string]string{"x":"0","y":"0"})
-  // At this time we do not support multiple assets with the same id. If a new asset
-  // comes in with the same id it will just replace the previously stored one. We test
-  // for nil here to make sure we don't replace an existing asset with nil.
-  if ss != nil {
-    a.asset = ss
+  head, body := data[0:svgelement], data[svgelement:]
+  newAsset := func(errorlabel string, vbox string, metadata map[string]string) Asset {
+    a := newSVGImageAsset(errorlabel, vbox, head, body, metadata)
+    if a == nil { return nil }
+    a.(*SVGAsset).Layers = layers
+    a.(*SVGAsset).Texts = texts
+    return a
   }
   
-  addSVGSubAssets(pth, metadata, a, data[0:svgelement], data[svgelement:])
+  master := map[string]string{"x":"0","y":"0","description":svgDocumentMeta(pth, docparts)}
+  addSubAssets(pth, metadata, a, master, parseViewBox(viewBox), func(errorlabel string, box *sdl.Rect, metadata map[string]string) Asset {
+    // Each rectangle describes a sub-asset to be extracted by inserting a viewBox= attribute
+    // between head and body.
+    viewBox := fmt.Sprintf("%v %v %v %v", box.X, box.Y, box.W, box.H)
+    return newAsset(errorlabel, viewBox, metadata)
+  })
+  a.put(newAsset(pth, viewBox, master), "")
 } 
 
-// metadata contains attributes of <rect> elements within the <g> with id/label "METADATA".
+// metadata contains one map per sub-asset with the keys "id","x","y","width","height"
+// describing the sub-asset's rectangle. For SVG images these are the attributes of
+// <rect> elements within the <g> with id/label "METADATA".
 // In addition to the element attributes, if the <rect> has a <desc> child, that element's
 // content is stored under the name "description" in the respective map.
 //
-// Each rectangle describes a sub-asset to be extracted by inserting a viewBox= attribute
-// between head and body (which are XML code of the SVG asset).
+// Entries without "width" and "height" are points (see applyPoints()) and entries
+// with "shape" are collision shapes (see applyShapes()).
+//
+// Rectangles fully contained in another rectangle become sub-assets of the asset for
+// the smallest such rectangle. For each rectangle, newAsset is called with the rectangle
+// and its metadata map whose "x" and "y" have been replaced with the coordinates relative
+// to the enclosing rectangle. If the result is not nil it is put into the pile.
+// If multiple image assets with the same parent have the same id after removing trailing
+// digits (e.g. "run1", "run2"), they become the frames of an Animation, ordered by
+// their numbers.
 //
 // a is the parent under which collected sub-assets are inserted into the pile.
 //
+// master and masterbox are the metadata and rectangle of the whole-file asset, which
+// receives the points outside of all rectangles (see applyPoints()). They may be nil.
+// The caller creates the whole-file asset from master after addSubAssets() returns.
+//
 // pth is the path of the main asset. It is used only in error log messages.
-func addSVGSubAssets(pth string, metadata []map[string]string, a *pile, head, body []byte) {
+func addSubAssets(pth string, metadata []map[string]string, a *pile, master map[string]string, masterbox *sdl.Rect, newAsset func(errorlabel string, box *sdl.Rect, metadata map[string]string) Asset) {
+  metadata, points, shapes := splitMarks(metadata)
   indexes := make([]int,0,len(metadata))
   rects := make([]*sdl.Rect,len(metadata))
   for i := range rects {
@@ -312,6 +402,10 @@ func addSVGSubAssets(pth string, metadata []map[string]string, a *pile, head, bo
       indexes = append(indexes, i)
     }
   }
+  
+  indexes = applyNineSlices(pth, metadata, rects, indexes)
+  applyPoints(pth, points, metadata, rects, indexes, master, masterbox)
+  applyShapes(pth, shapes, metadata, rects, indexes)
 
   // sort by ascending area, i.e. rects[indexes[0]] is the largest rectangle
   sort.Slice(indexes, func(i, j int) bool { return rects[indexes[i]].W*rects[indexes[i]].H > rects[indexes[j]].W*rects[indexes[j]].H })  
@@ -319,6 +413,11 @@ func addSVGSubAssets(pth string, metadata []map[string]string, a *pile, head, bo
   stack := []*sdl.Rect{}
   asstack := []*pile{}
   
+  // assets whose ids end in digits, collected per pile, to be turned into animations
+  frames := map[*pile][]animFrame{}
+  framepiles := []*pile{} // keys of frames in order of insertion
+  framerects := map[*pile]string{} // id of the first rectangle of each animation
+  
   for {
     foundidx := -1
     for i,idx := range indexes {
@@ -347,7 +446,7 @@ func addSVGSubAssets(pth string, metadata []map[string]string, a *pile, head, bo
       } else {
         aa := a.sub[idpart]
         if aa == nil {
-          aa = &pile{sub:map[string]*pile{}}
+          aa = &pile{sub:map[string]*pile{}, path:a.path+"/"+idpart}
           a.sub[idpart] = aa
         }
         asstack = append(asstack, a)
@@ -362,17 +461,21 @@ func addSVGSubAssets(pth string, metadata []map[string]string, a *pile, head, bo
         }
         metadata[foundidx]["x"] = strconv.Itoa(x)
         metadata[foundidx]["y"] = strconv.Itoa(y)
-        viewBox := fmt.Sprintf("%v %v %v %v", curect.X, curect.Y, curect.W, curect.H)
-        ss := newSVGImageAsset(pth+" => rect "+metadata[foundidx]["id"], viewBox, head, body, metadata[foundidx])
-        // At this time we do not support multiple assets with the same id. If a new asset
-        // comes in with the same id it will just replace the previously stored one. We test
-        // for nil here to make sure we don't replace an existing asset with nil.
-        if ss != nil {
-          a.asset = ss
+        asset := newAsset(pth+" => rect "+metadata[foundidx]["id"], curect, metadata[foundidx])
+        if num, err := strconv.Atoi(metadata[foundidx]["id"][len(idpart):]); err == nil && asset != nil {
+          if frames[a] == nil { framerects[a] = metadata[foundidx]["id"] }
+          if frames[a] == nil { framepiles = append(framepiles, a) }
+          frames[a] = append(frames[a], animFrame{num, asset, metadata[foundidx]})
+        } else {
+          a.put(asset, metadata[foundidx]["id"])
         }
       }
     }
   }
+  
+  for _, a := range framepiles {
+    a.put(newAnimation(pth, frames[a]), framerects[a])
+  }
 }
 
 // Takes a string with x,y,width,height coordinates (floating point) separated by whitespace
@@ -440,23 +543,148 @@ func newSVGImageAsset(errorlabel string, vbox string, head, body []byte, metadat
   cx := roundint32(width_half+cxf)
   cy := roundint32(height_half-cyf)
   
-  meta := util.AlmostJSON(fmt.Sprintf("%v\nx:%v\ny:%v\nwidth:%v\nheight:%v\ncenterx:%v\ncentery:%v\n",metadata["description"],metadata["x"],metadata["y"],box.W,box.H,cx,cy))
+  meta := imageMeta(errorlabel, metadata, box.W, box.H, cx, cy)
+  if meta == nil { return nil }
+  
+  return &SVGAsset{Head:head, Body:body, ViewBox: []byte("viewBox=\""+vbox+"\""), MetaJSON:meta}
+}
+
+// Returns the JSON metadata for an image asset with the given width, height and
+// center, whose "x", "y", "description", "nineslice" (see applyNineSlices()),
+// "points" (see applyPoints()) and "shapes" (see applyShapes()) are taken from metadata.
+// Returns nil if the result is not valid JSON. The error is appended to ShitLog.
+func imageMeta(errorlabel string, metadata map[string]string, width, height, cx, cy int32) []byte {
+  generated := ""
+  if metadata["nineslice"] != "" {
+    generated += fmt.Sprintf("slice:[%v]\n",metadata["nineslice"])
+  }
+  if metadata["points"] != "" {
+    generated += fmt.Sprintf("points:{%v}\n",metadata["points"])
+  }
+  if metadata["shapes"] != "" {
+    generated += fmt.Sprintf("shapes:[%v]\n",metadata["shapes"])
+  }
+  meta := util.AlmostJSON(fmt.Sprintf("%v\nx:%v\ny:%v\nwidth:%v\nheight:%v\ncenterx:%v\ncentery:%v\n%v",metadata["description"],metadata["x"],metadata["y"],width,height,cx,cy,generated))
   jsonMeta := map[string]interface{}{}
   err := json.Unmarshal(meta, &jsonMeta)
   if err != nil {
     ShitLog = append(ShitLog, fmt.Sprintf("%v: JSON conversion error: %v '%v'",errorlabel,err,string(meta)))
     return nil
   }
-  
-  return &SVGAsset{Head:head, Body:body, ViewBox: []byte("viewBox=\""+vbox+"\""), MetaJSON:meta}
+  return meta
 }
 
 func (a *SVGAsset) Meta(target interface{}) error {
   return json.Unmarshal(a.MetaJSON, target)
 }
 
+func (a *SVGAsset) metaJSON() *[]byte {
+  return &a.MetaJSON
+}
+
+// Returns the part r of a (see sliceable) with a viewBox that covers only r.
+func (a *SVGAsset) slice(r sdl.Rect) ImageAsset {
+  vbox := strings.TrimSuffix(strings.TrimPrefix(string(a.ViewBox), "viewBox=\""), "\"")
+  box := parseViewBox(vbox)
+  if box == nil { return nil }
+  vbox = fmt.Sprintf("%v %v %v %v", box.X+r.X, box.Y+r.Y, r.W, r.H)
+  return &SVGAsset{Head:a.Head, ViewBox:[]byte("viewBox=\""+vbox+"\""), Body:a.Body, MetaJSON:a.MetaJSON, Layers:a.Layers, Texts:a.Texts}
+}
+
 func (a *SVGAsset) Render(width,height int) ([]uint32,error) {
+  return a.RenderWith(width, height, nil)
+}
+
+// Returns the parts that make up the SVG source code (Head, ViewBox and Body)
+// modified according to opt. Hidden layers are omitted completely.
+func (a *SVGAsset) source(opt *RenderOptions) ([][]byte, error) {
+  if opt == nil { opt = &RenderOptions{} }
+  
+  for label := range opt.Layers {
+    found := false
+    for _, l := range a.Layers {
+      if l.Label == label { found = true }
+    }
+    if !found { return nil, ErrLayer }
+  }
+  
+  colors, err := opt.colors()
+  if err != nil { return nil, err }
+  style, err := opt.style()
+  if err != nil { return nil, err }
+  if len(a.Body) == 0 || a.Body[0] != '>' { style = nil }
+  
+  // Body[edits[i].start:edits[i].end] is replaced with edits[i].replacement.
+  type edit struct {
+    start, end int
+    replacement []byte
+  }
+  edits := []edit{}
+  if style != nil { // insert <style> as first child of <svg>
+    edits = append(edits, edit{1, 1, style})
+  }
+  for _, l := range a.Layers {
+    show, ok := opt.Layers[l.Label]
+    if !ok { continue }
+    if !show {
+      edits = append(edits, edit{l.Start, l.End, nil})
+    } else if l.Hidden {
+      edits = append(edits, edit{l.displayStart, l.displayEnd, []byte("display:inline")})
+    }
+  }
+  for _, t := range a.Texts {
+    if value, ok := opt.Text[t.ID]; ok {
+      edits = append(edits, edit{t.Start, t.End, []byte(html.EscapeString(value))})
+    }
+  }
+  sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+  
+  parts := [][]byte{}
+  
+  // Appends src (a part of the original source code) to parts, with placeholders
+  // replaced by opt.Text and colors replaced by colors.
+  addSource := func(src []byte) {
+    for len(opt.Text) > 0 {
+      i := bytes.Index(src, []byte("{{"))
+      if i < 0 { break }
+      j := bytes.Index(src[i:], []byte("}}"))
+      if j < 0 { break }
+      value, ok := opt.Text[strings.TrimSpace(string(src[i+2:i+j]))]
+      if !ok { // not a known placeholder, skip only "{{" in case a placeholder follows
+        j = 0
+        value = "{{"
+      }
+      parts = append(parts, replaceColors(src[0:i], colors), []byte(html.EscapeString(value)))
+      src = src[i+j+2:]
+    }
+    parts = append(parts, replaceColors(src, colors))
+  }
+  
+  addSource(a.Head)
+  parts = append(parts, a.ViewBox)
+  pos := 0
+  for _, e := range edits {
+    if e.start < pos { continue } // contained in a previous edit, e.g. text in a hidden layer
+    addSource(a.Body[pos:e.start])
+    parts = append(parts, e.replacement)
+    pos = e.end
+  }
+  addSource(a.Body[pos:])
+  return parts, nil
+}
+
+// Returns the versions of the librsvg and cairo libraries used by RenderWith(),
+// whose output may change with them.
+func rendererVersion() string {
+  return fmt.Sprintf("librsvg %v.%v.%v cairo %v", C.rsvg_major_version, C.rsvg_minor_version, C.rsvg_micro_version, C.GoString(C.cairo_version_string()))
+}
+
+// Like Render() but modified according to opt (which may be nil).
+func (a *SVGAsset) RenderWith(width,height int, opt *RenderOptions) ([]uint32,error) {
   if width <= 0 || height <= 0 { return nil, ErrIllDimensions }
+  
+  parts, err := a.source(opt)
+  if err != nil { return nil, err }
 
   rsvg_handle := C.rsvg_handle_new_with_flags(C.RSVG_HANDLE_FLAG_UNLIMITED|C.RSVG_HANDLE_FLAG_KEEP_IMAGE_DATA)
   if rsvg_handle == nil {
@@ -466,24 +694,9 @@ func (a *SVGAsset) Render(width,height int) ([]uint32,error) {
 
   var gerr *C.GError
   
-  if len(a.Head) > 0 {
-    C.rsvg_handle_write(rsvg_handle, (*C.guchar)(unsafe.Pointer(&(a.Head[0]))), C.gsize(len(a.Head)), &gerr)
-    if gerr != nil {
-      defer C.g_error_free(gerr)
-      return nil, errors.New(C.GoString((*C.char)(gerr.message)))
-    }
-  }
-  
-  if len(a.ViewBox) > 0 {
-    C.rsvg_handle_write(rsvg_handle, (*C.guchar)(unsafe.Pointer(&(a.ViewBox[0]))), C.gsize(len(a.ViewBox)), &gerr)
-    if gerr != nil {
-      defer C.g_error_free(gerr)
-      return nil, errors.New(C.GoString((*C.char)(gerr.message)))
-    }
-  }
-  
-  if len(a.Body) > 0 {
-    C.rsvg_handle_write(rsvg_handle, (*C.guchar)(unsafe.Pointer(&(a.Body[0]))), C.gsize(len(a.Body)), &gerr)
+  for _, part := range parts {
+    if len(part) == 0 { continue }
+    C.rsvg_handle_write(rsvg_handle, (*C.guchar)(unsafe.Pointer(&(part[0]))), C.gsize(len(part)), &gerr)
     if gerr != nil {
       defer C.g_error_free(gerr)
       return nil, errors.New(C.GoString((*C.char)(gerr.message)))
@@ -0,0 +1,103 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "os"
+         "fmt"
+         "path"
+         "strings"
+         "encoding/json"
+         
+         "github.com/mbenkmann/golib/util"
+)
+
+// If true, Meta() merges the metadata of an asset with that of its parents.
+var InheritMeta = false
+
+// Stores the metadata in data (the contents of the ".assets" file of the directory
+// dir, in the syntax of descriptions) as defaults for all assets in and below dir.
+// Errors are appended to ShitLog.
+func addDefaults(dir string, data []byte) {
+  file := path.Join(dir, ".assets")
+  pile := assets
+  dir = strings.ToLower(path.Clean(dir))
+  if dir != "." && dir != "/" {
+    id := assetID(dir)
+    if id == nil { return }
+    pile = makePile(id)
+  }
+  
+  defaults := map[string]interface{}{}
+  err := json.Unmarshal(util.AlmostJSON(string(data)), &defaults)
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",file,err))
+    return
+  }
+  pile.provide(nil, "", "", defaults, file)
+}
+
+// Unmarshals p's metadata into target. If InheritMeta is true, the metadata is
+// inheritedMeta().
+func (p *pile) meta(target interface{}) error {
+  if !InheritMeta { return p.asset.Meta(target) }
+  meta, err := inheritedMeta(p.path, p.asset)
+  if err != nil { return err }
+  data, err := json.Marshal(meta)
+  if err != nil { return err }
+  return json.Unmarshal(data, target)
+}
+
+// Returns the metadata of asset (which has path pth, but may be shadowed by another
+// overlay) merged with the metadata of all assets and directory defaults above it,
+// starting at the top. At each level, the
+// directory defaults come before the asset's metadata and keys override those of
+// previous levels. Keys generated by assman (like "x" or "frames") describe a single
+// asset and are not inherited.
+func inheritedMeta(pth string, asset Asset) (map[string]interface{}, error) {
+  merged := map[string]interface{}{}
+  merge := func(meta map[string]interface{}, own bool) {
+    for k, v := range meta {
+      if own || !generatedMetaKeys[k] { merged[k] = v }
+    }
+  }
+  
+  p := assets
+  pths := []string{}
+  if pth != "" { pths = strings.Split(pth, "/") }
+  for i := 0; ; i++ {
+    merge(p.defaults, false)
+    if i == len(pths) { break }
+    if p.asset != nil {
+      var meta map[string]interface{}
+      if err := p.asset.Meta(&meta); err != nil { return nil, err }
+      merge(meta, false)
+    }
+    p = p.sub[pths[i]]
+    if p == nil { return nil, os.ErrNotExist }
+  }
+  var meta map[string]interface{}
+  if err := asset.Meta(&meta); err != nil { return nil, err }
+  merge(meta, true)
+  return merged, nil
+}
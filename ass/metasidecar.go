@@ -0,0 +1,116 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "path"
+         "strings"
+         "io/ioutil"
+         "encoding/json"
+         
+         "gopkg.in/yaml.v3"
+         "github.com/pelletier/go-toml"
+)
+
+// The extensions of metadata sidecar files in the order in which they are applied.
+var metaSidecarExts = []string{".meta.json", ".meta.yaml", ".meta.yml", ".meta.toml"}
+
+// Implemented by assets whose metadata can be changed. Returns a pointer to the
+// metadata in JSON format.
+type metaJSONer interface {
+  metaJSON() *[]byte
+}
+
+// Reads the metadata sidecar files (file+metaSidecarExts[...]) of the asset file
+// file, which has been loaded as asset path pth, and merges their contents into the
+// metadata of the assets in loaded. The top-level keys of a sidecar are asset paths
+// relative to the directory of file (e.g. "car" and "car/wheel" for "car.svg")
+// and their values are objects whose keys override the asset's metadata.
+// Keys generated by assman (like "width") cannot be overridden.
+// Errors are appended to ShitLog.
+func applyMetaSidecars(file string, pth string, loaded []*pile) {
+  for _, ext := range metaSidecarExts {
+    data, err := ioutil.ReadFile(file+ext)
+    if err != nil { continue } // usually does not exist
+    
+    sidecar := map[string]interface{}{}
+    switch ext {
+      case ".meta.json": err = json.Unmarshal(data, &sidecar)
+      case ".meta.toml": err = toml.Unmarshal(data, &sidecar)
+      default: err = yaml.Unmarshal(data, &sidecar)
+    }
+    if err != nil {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",file+ext,err))
+      continue
+    }
+    
+    for key, value := range sidecar {
+      label := fmt.Sprintf("%v => %v",file+ext,key)
+      
+      id := strings.Split(strings.ToLower(path.Join(path.Dir(pth), key)), "/")
+      if id[0] == "" { id = id[1:] } // in case pth starts with "/"
+      for i := range id { id[i] = strings.TrimRight(id[i], "0123456789") }
+      var p *pile
+      for _, l := range loaded {
+        if l.path == strings.Join(id, "/") { p = l }
+      }
+      if p == nil {
+        ShitLog = append(ShitLog, fmt.Sprintf("%v: No such asset in %v",label,file))
+        continue
+      }
+      
+      override, ok := value.(map[string]interface{})
+      if !ok {
+        ShitLog = append(ShitLog, fmt.Sprintf("%v: Not an object",label))
+        continue
+      }
+      
+      mj, ok := p.asset.(metaJSONer)
+      if !ok {
+        ShitLog = append(ShitLog, fmt.Sprintf("%v: Asset has no metadata",label))
+        continue
+      }
+      metajson := mj.metaJSON()
+      meta := map[string]interface{}{}
+      err := json.Unmarshal(*metajson, &meta)
+      if err != nil {
+        ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",label,err))
+        continue
+      }
+      for k, v := range override {
+        if generatedMetaKeys[k] {
+          ShitLog = append(ShitLog, fmt.Sprintf("%v: Key \"%v\" cannot be overridden",label,k))
+        } else {
+          meta[k] = v
+        }
+      }
+      data, err := json.Marshal(meta)
+      if err != nil {
+        ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",label,err))
+        continue
+      }
+      *metajson = data
+    }
+  }
+}
@@ -0,0 +1,307 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "os"
+         "math"
+         "path"
+         "sort"
+         "sync"
+         "strings"
+)
+
+// Identifies a voice of a Mixer.
+type VoiceID int
+
+// Options for Mixer.Play().
+type PlayOptions struct {
+  // Factor for the amplitude. 1 is the original volume. Values <= 0 are treated
+  // as 1, so that PlayOptions need not set it. To start a voice silently, use
+  // FadeIn or SetVolume().
+  Volume float64
+  // -1 is left, 0 is center, 1 is right. The channel opposite to the pan direction is
+  // attenuated. Only affects the first 2 channels of the output.
+  Pan float64
+  // Factor for the playback speed. 2 plays the sound an octave higher and twice as fast.
+  // Values <= 0 are treated as 1.
+  Pitch float64
+  // If true, the sound is repeated (from its loop start, if it has loop points).
+  Loop bool
+  // The volume rises from 0 to Volume within FadeIn seconds.
+  FadeIn float64
+}
+
+// Plays sound assets by their paths and mixes them into a single stream of PCM data.
+// The output depends only on the calls made (not on timing), so the mixer works
+// without an audio device. All methods may be called from different goroutines, e.g.
+// Play() from the game loop and Read() from an SDL audio callback.
+type Mixer struct {
+  format SoundFormat
+  voices []*voice
+  // asset path prefix => max. number of voices
+  limits map[string]int
+  // the VoiceID for the next voice
+  next VoiceID
+  // reused by Read()
+  out []float32
+  mutex sync.Mutex
+}
+
+// A sound played by a Mixer.
+type voice struct {
+  id VoiceID
+  // normalized asset path
+  pth string
+  stream *SoundStream
+  volume, pan, pitch float64
+  
+  // Frames read from stream but not yet consumed.
+  buf []float32
+  // The position of the next output frame in buf (in frames).
+  pos float64
+  // true if stream has no more data.
+  ended bool
+  
+  // current fade factor and its change per output frame
+  fade, fadestep float64
+  // true if the voice is to be removed when fade reaches 0
+  stopping bool
+  
+  // reused by mix() for reading from stream
+  chunk []float32
+}
+
+// Returns a new Mixer whose output is in format.
+func NewMixer(format SoundFormat) (*Mixer, error) {
+  if !format.valid() { return nil, ErrIllFormat }
+  return &Mixer{format:format, limits:map[string]int{}, next:1}, nil
+}
+
+// Normalizes an asset path the way find() does, but without leading "/".
+func normalizePath(pth string) string {
+  pth = strings.ToLower(path.Clean(pth))
+  return strings.TrimLeft(pth, "/")
+}
+
+// Limits the number of voices playing assets whose path is prefix or starts
+// with prefix+"/" to max. If max <= 0, the limit is removed. When Play() would
+// exceed a limit, the oldest voice in the group is stopped.
+func (m *Mixer) SetLimit(prefix string, max int) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  prefix = normalizePath(prefix)
+  if max <= 0 {
+    delete(m.limits, prefix)
+  } else {
+    m.limits[prefix] = max
+  }
+}
+
+// Starts playing the sound asset with the given asset_path. If opt is nil, the sound
+// is played with its original volume and pitch, centered and looped if it has loop points.
+func (m *Mixer) Play(asset_path string, opt *PlayOptions) (VoiceID, error) {
+  pil := find(asset_path)
+  if pil == nil { return 0, os.ErrNotExist }
+  stass, ok := pil.asset.(streamable)
+  if !ok { return 0, ErrAssetType }
+  
+  stream, err := newSoundStream(stass, SoundFormat{Freq:m.format.Freq, Channels:m.format.Channels, Type:SampleFloat32})
+  if err != nil { return 0, err }
+  
+  v := &voice{pth:normalizePath(asset_path), stream:stream, volume:1, pitch:1, fade:1}
+  if opt != nil {
+    if opt.Volume > 0 { v.volume = opt.Volume }
+    v.pan = opt.Pan
+    if opt.Pitch > 0 { v.pitch = opt.Pitch }
+    stream.Loop = opt.Loop
+    if opt.FadeIn > 0 {
+      v.fade = 0
+      v.fadestep = 1/(opt.FadeIn*float64(m.format.Freq))
+    }
+  }
+  
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  // sorted, so that the voices stopped do not depend on map order
+  prefixes := make([]string, 0, len(m.limits))
+  for prefix := range m.limits { prefixes = append(prefixes, prefix) }
+  sort.Strings(prefixes)
+  for _, prefix := range prefixes {
+    max := m.limits[prefix]
+    if !(v.pth == prefix || prefix == "" || strings.HasPrefix(v.pth, prefix+"/")) { continue }
+    count := 0
+    for i := len(m.voices)-1; i >= 0; i-- { // newest first
+      w := m.voices[i]
+      if w.pth == prefix || prefix == "" || strings.HasPrefix(w.pth, prefix+"/") {
+        count++
+        if count >= max { m.voices = append(m.voices[0:i], m.voices[i+1:]...) }
+      }
+    }
+  }
+  
+  v.id = m.next
+  m.next++
+  m.voices = append(m.voices, v)
+  return v.id, nil
+}
+
+// Returns the voice with the given id or nil. m.mutex must be locked.
+func (m *Mixer) voice(id VoiceID) *voice {
+  for _, v := range m.voices {
+    if v.id == id { return v }
+  }
+  return nil
+}
+
+// Stops the voice with the given id. If fadeout > 0, the volume falls to 0 within
+// fadeout seconds before the voice stops. Does nothing if the voice has ended already.
+func (m *Mixer) Stop(id VoiceID, fadeout float64) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  v := m.voice(id)
+  if v == nil { return }
+  v.stopping = true
+  if fadeout > 0 {
+    v.fadestep = -v.fade/(fadeout*float64(m.format.Freq))
+  } else {
+    v.fade = 0
+  }
+}
+
+// Stops all voices immediately.
+func (m *Mixer) StopAll() {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  m.voices = nil
+}
+
+// Returns true if the voice with the given id is still playing.
+func (m *Mixer) Playing(id VoiceID) bool {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  return m.voice(id) != nil
+}
+
+// Changes the volume of the voice with the given id (see PlayOptions).
+func (m *Mixer) SetVolume(id VoiceID, volume float64) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if v := m.voice(id); v != nil { v.volume = volume }
+}
+
+// Changes the pan of the voice with the given id (see PlayOptions).
+func (m *Mixer) SetPan(id VoiceID, pan float64) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if v := m.voice(id); v != nil { v.pan = pan }
+}
+
+// Changes the pitch of the voice with the given id (see PlayOptions).
+func (m *Mixer) SetPitch(id VoiceID, pitch float64) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if pitch <= 0 { pitch = 1 }
+  if v := m.voice(id); v != nil { v.pitch = pitch }
+}
+
+// Mixes the next len(out)/Channels frames of all voices into out as float32 samples
+// with the mixer's sample rate and number of channels. Samples may exceed -1.0..1.0
+// if many loud voices play at once. Voices that have ended are removed.
+func (m *Mixer) Mix(out []float32) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  m.mix(out)
+}
+
+// Like Mix() but m.mutex must be locked.
+func (m *Mixer) mix(out []float32) {
+  for i := range out { out[i] = 0 }
+  alive := m.voices[0:0]
+  for _, v := range m.voices {
+    if v.mix(out, m.format.Channels) { alive = append(alive, v) }
+  }
+  for i := len(alive); i < len(m.voices); i++ { m.voices[i] = nil }
+  m.voices = alive
+}
+
+// Mixes the next frames into p in the mixer's format. Always fills p completely
+// (with silence if no voices are playing) and never returns an error. Only whole
+// frames are written, so len(p) should be a multiple of the frame size.
+func (m *Mixer) Read(p []byte) (int, error) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  fs := m.format.frameSize()
+  n := len(p)/fs*m.format.Channels
+  if cap(m.out) < n { m.out = make([]float32, n) }
+  out := m.out[0:n]
+  m.mix(out)
+  putSamples(p, out, m.format.Type)
+  return len(out)/m.format.Channels*fs, nil
+}
+
+// Adds the voice's next len(out)/channels frames to out. Returns false if the voice
+// has ended and is to be removed.
+func (v *voice) mix(out []float32, channels int) bool {
+  // panning attenuates the opposite channel
+  pan := math.Max(-1, math.Min(1, v.pan))
+  left, right := math.Min(1, 1-pan), math.Min(1, 1+pan)
+  
+  frames := len(out)/channels
+  for f := 0; f < frames; f++ {
+    i := int(v.pos)
+    // linear interpolation between frames i and i+1 requires i+1 to be in buf
+    for !v.ended && len(v.buf)/channels <= i+1 {
+      if v.chunk == nil { v.chunk = make([]float32, streamChunk*channels) }
+      n := v.stream.readConverted(v.chunk)
+      if n == 0 { v.ended = true }
+      v.buf = append(v.buf, v.chunk[0:n*channels]...)
+    }
+    if i >= len(v.buf)/channels { return false }
+    
+    if v.stopping && v.fade <= 0 { return false }
+    gain := v.volume*v.fade
+    v.fade = math.Max(0, math.Min(1, v.fade+v.fadestep))
+    if v.fade == 1 && !v.stopping { v.fadestep = 0 }
+    
+    frac := float32(v.pos-float64(i))
+    for c := 0; c < channels; c++ {
+      s0 := v.buf[i*channels+c]
+      var s1 float32
+      if (i+1)*channels+c < len(v.buf) { s1 = v.buf[(i+1)*channels+c] }
+      g := gain
+      if c == 0 && channels >= 2 { g *= left }
+      if c == 1 { g *= right }
+      out[f*channels+c] += (s0+(s1-s0)*frac)*float32(g)
+    }
+    v.pos += v.pitch
+  }
+  
+  // discard consumed frames
+  if drop := int(v.pos); drop > 0 {
+    if drop*channels > len(v.buf) { drop = len(v.buf)/channels }
+    v.buf = append(v.buf[0:0], v.buf[drop*channels:]...)
+    v.pos -= float64(drop)
+  }
+  return true
+}
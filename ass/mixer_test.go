@@ -0,0 +1,144 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+package ass
+
+import (
+         "os"
+         "testing"
+         "encoding/binary"
+)
+
+// Returns a mono 16 bit WAV file with the given sample rate and a constant
+// sample value.
+func constantWAV(freq, frames int, value int16) []byte {
+  le := binary.LittleEndian
+  fmtc := make([]byte, 16)
+  le.PutUint16(fmtc[0:], 1)
+  le.PutUint16(fmtc[2:], 1)
+  le.PutUint32(fmtc[4:], uint32(freq))
+  le.PutUint32(fmtc[8:], uint32(freq*2))
+  le.PutUint16(fmtc[12:], 2)
+  le.PutUint16(fmtc[14:], 16)
+  data := make([]byte, 2*frames)
+  for i := 0; i < frames; i++ { le.PutUint16(data[2*i:], uint16(value)) }
+  
+  b := []byte("WAVE")
+  b = append(append(append(b, "fmt "...), le.AppendUint32(nil, 16)...), fmtc...)
+  b = append(append(append(b, "data"...), le.AppendUint32(nil, uint32(len(data)))...), data...)
+  return append(append([]byte("RIFF"), le.AppendUint32(nil, uint32(len(b)))...), b...)
+}
+
+// Adds the sounds "sfx/step/a" and "sfx/step/b" (constant 0.5, 100 frames at
+// 100Hz) and "sfx/music" (constant 0.25, 1000 frames).
+func addMixerSounds(t *testing.T) {
+  dir := t.TempDir()
+  os.MkdirAll(dir+"/sfx/step", 0755)
+  os.WriteFile(dir+"/sfx/step/a.wav", constantWAV(100, 100, 16384), 0644)
+  os.WriteFile(dir+"/sfx/step/b.wav", constantWAV(100, 100, 16384), 0644)
+  os.WriteFile(dir+"/sfx/music.wav", constantWAV(100, 1000, 8192), 0644)
+  wd, _ := os.Getwd()
+  defer os.Chdir(wd)
+  os.Chdir(dir)
+  ShitLog = nil
+  if err := Add("sfx"); err != nil || len(ShitLog) > 0 { t.Fatal(err, ShitLog) }
+}
+
+func newTestMixer(t *testing.T) *Mixer {
+  m, err := NewMixer(SoundFormat{Freq:100, Channels:2, Type:SampleFloat32})
+  if err != nil { t.Fatal(err) }
+  return m
+}
+
+func TestMixerDeterministic(t *testing.T) {
+  addMixerSounds(t)
+  run := func() []float32 {
+    m := newTestMixer(t)
+    m.SetLimit("sfx/step", 1)
+    m.SetLimit("sfx", 2)
+    var out []float32
+    buf := make([]float32, 2*16)
+    for i := 0; i < 8; i++ {
+      m.Play("sfx/step/a", &PlayOptions{Pan:-0.5})
+      m.Play("sfx/music", &PlayOptions{Volume:0.5, Pitch:1.5, FadeIn:0.1})
+      m.Mix(buf)
+      out = append(out, buf...)
+    }
+    return out
+  }
+  first := run()
+  for i := 0; i < 10; i++ {
+    again := run()
+    for k := range first {
+      if again[k] != first[k] { t.Fatalf("run %v differs at sample %v: %v != %v", i, k, again[k], first[k]) }
+    }
+  }
+}
+
+func TestMixerDefaultVolume(t *testing.T) {
+  addMixerSounds(t)
+  m := newTestMixer(t)
+  m.Play("sfx/step/a", &PlayOptions{Loop:true})
+  out := make([]float32, 2*4)
+  m.Mix(out)
+  for i, s := range out {
+    if s < 0.49 || s > 0.51 { t.Fatalf("sample %v is %v, expected 0.5", i, s) }
+  }
+}
+
+func TestMixerLimit(t *testing.T) {
+  addMixerSounds(t)
+  m := newTestMixer(t)
+  m.SetLimit("sfx/step", 2)
+  a, _ := m.Play("sfx/step/a", nil)
+  b, _ := m.Play("sfx/step/b", nil)
+  music, _ := m.Play("sfx/music", nil)
+  c, _ := m.Play("sfx/step/a", nil)
+  if m.Playing(a) || !m.Playing(b) || !m.Playing(c) || !m.Playing(music) {
+    t.Fatalf("expected oldest step voice to be stolen: %v %v %v %v", m.Playing(a), m.Playing(b), m.Playing(c), m.Playing(music))
+  }
+  
+  // overlapping limits: both apply
+  m.StopAll()
+  m.SetLimit("sfx", 2)
+  a, _ = m.Play("sfx/music", nil)
+  b, _ = m.Play("sfx/step/a", nil)
+  c, _ = m.Play("sfx/step/b", nil)
+  if m.Playing(a) || !m.Playing(b) || !m.Playing(c) {
+    t.Fatalf("expected music to be stolen: %v %v %v", m.Playing(a), m.Playing(b), m.Playing(c))
+  }
+  
+  out := make([]float32, 2*200)
+  m.Mix(out)
+  if m.Playing(b) || m.Playing(c) { t.Fatal("ended voices not removed") }
+  if out[0] < 0.99 || out[0] > 1.01 || out[2*150] != 0 { t.Fatalf("unexpected mix %v %v", out[0], out[2*150]) }
+}
+
+func TestMixerReadAllocs(t *testing.T) {
+  addMixerSounds(t)
+  m := newTestMixer(t)
+  m.Play("sfx/music", &PlayOptions{Loop:true})
+  p := make([]byte, 8*32)
+  m.Read(p)
+  if n := testing.AllocsPerRun(50, func() { m.Read(p) }); n > 0 {
+    t.Fatalf("Read() allocates %v times per call", n)
+  }
+}
@@ -0,0 +1,137 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "math"
+         "strings"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Removes the rectangles with id "NINESLICE" (after removing trailing digits) from
+// indexes and returns the result. Each such rectangle marks the stretchable center
+// of the smallest other rectangle that contains it. The insets (left, top, right,
+// bottom) are stored as "nineslice" in that rectangle's metadata map.
+// rects and indexes are as in addSubAssets().
+func applyNineSlices(pth string, metadata []map[string]string, rects []*sdl.Rect, indexes []int) []int {
+  remaining := make([]int, 0, len(indexes))
+  for _, i := range indexes {
+    if strings.TrimRight(metadata[i]["id"], "0123456789") != "NINESLICE" {
+      remaining = append(remaining, i)
+    }
+  }
+  
+  for _, i := range indexes {
+    if strings.TrimRight(metadata[i]["id"], "0123456789") != "NINESLICE" { continue }
+    
+    parent := -1
+    for _, j := range remaining {
+      uni := rects[i].Union(rects[j])
+      if uni.Equals(rects[j]) && (parent < 0 || rects[j].W*rects[j].H < rects[parent].W*rects[parent].H) {
+        parent = j
+      }
+    }
+    if parent < 0 {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => rect %v: Not contained in another rectangle",pth,metadata[i]["id"]))
+      continue
+    }
+    
+    r, p := rects[i], rects[parent]
+    metadata[parent]["nineslice"] = fmt.Sprintf("%v,%v,%v,%v", r.X-p.X, r.Y-p.Y, p.X+p.W-r.X-r.W, p.Y+p.H-r.Y-r.H)
+  }
+  
+  return remaining
+}
+
+// Image assets that can be cut into parts for renderNineSlice().
+type sliceable interface {
+  // Returns the part r (in the units of "width" and "height" of the metadata) of
+  // the image as an image asset that renders only that part, or nil if that is
+  // not possible.
+  slice(r sdl.Rect) ImageAsset
+}
+
+// Renders a with the given width*height as a nine-slice, using render (which renders
+// an image like its Render() but may apply RenderOptions).
+// The "slice" metadata of a is [left, top, right, bottom] in the units of "width" and
+// "height". It divides the image into 3x3 parts. The corners keep their native
+// size, the top and bottom edges are stretched horizontally, the left and right edges
+// vertically and the center in both directions. Each part is rendered separately
+// with its size in the result.
+func renderNineSlice(a ImageAsset, width, height int, render func(a ImageAsset, width, height int) ([]uint32,error)) ([]uint32,error) {
+  var meta struct {
+    Width, Height int
+    Slice []float64
+  }
+  s, ok := a.(sliceable)
+  if !ok { return nil, ErrSlice }
+  if err := a.Meta(&meta); err != nil || len(meta.Slice) != 4 { return nil, ErrSlice }
+  
+  var inset [4]int // left, top, right, bottom
+  for i := range inset {
+    inset[i] = int(math.Floor(meta.Slice[i]+.5))
+    if inset[i] < 0 { return nil, ErrSlice }
+  }
+  srcw := meta.Width-inset[0]-inset[2]
+  srch := meta.Height-inset[1]-inset[3]
+  if srcw < 0 || srch < 0 { return nil, ErrSlice }
+  
+  // the size of the center in the result
+  cw := width-inset[0]-inset[2]
+  ch := height-inset[1]-inset[3]
+  if width <= 0 || height <= 0 || cw < 0 || ch < 0 { return nil, ErrIllDimensions }
+  if (srcw == 0 && cw > 0) || (srch == 0 && ch > 0) { return nil, ErrSlice }
+  
+  // Column c of the result is the part of a at x coordinate partx[c] with width
+  // partw[c], rendered with width resw[c]. Same for rows.
+  partx := [3]int{0, inset[0], meta.Width-inset[2]}
+  partw := [3]int{inset[0], srcw, inset[2]}
+  resw := [3]int{inset[0], cw, inset[2]}
+  party := [3]int{0, inset[1], meta.Height-inset[3]}
+  parth := [3]int{inset[1], srch, inset[3]}
+  resh := [3]int{inset[1], ch, inset[3]}
+  
+  result := make([]uint32, width*height)
+  resy := 0
+  for row := 0; row < 3; row++ {
+    resx := 0
+    for col := 0; col < 3; col++ {
+      w, h := resw[col], resh[row]
+      if w > 0 && h > 0 {
+        part := s.slice(sdl.Rect{int32(partx[col]), int32(party[row]), int32(partw[col]), int32(parth[row])})
+        if part == nil { return nil, ErrSlice }
+        img, err := render(part, w, h)
+        if err != nil { return nil, err }
+        for y := 0; y < h; y++ {
+          dst := (resy+y)*width+resx
+          copy(result[dst:dst+w], img[y*w:(y+1)*w])
+        }
+      }
+      resx += resw[col]
+    }
+    resy += resh[row]
+  }
+  return result, nil
+}
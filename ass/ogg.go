@@ -0,0 +1,170 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "io"
+         "fmt"
+         "sync"
+         "bytes"
+         "strings"
+         "strconv"
+         "encoding/json"
+         
+         "github.com/jfreymuth/oggvorbis"
+)
+
+// Ogg Vorbis files longer than this (in seconds) are not decoded by Add(). They are
+// stored as VorbisAssets which decode on demand, e.g. when read via Stream().
+var StreamThreshold = 10.0
+
+// A sound (or a part of one) from an Ogg Vorbis file that is decoded on demand.
+type VorbisAsset struct {
+  // The complete Ogg Vorbis file. Shared by all assets from the same file.
+  Data []byte
+  
+  // Sample frames per second of the decoded data.
+  Freq int
+  
+  // Number of channels of the decoded data.
+  Channels int
+  
+  // The speaker position of each channel. nil if unknown.
+  layout []speaker
+  
+  // The decoded sample frames Start to End (exclusive) make up the asset.
+  Start, End int
+  
+  // Loop points in sample frames relative to Start. LoopEnd is exclusive.
+  // If LoopEnd <= LoopStart, the sound has no loop.
+  LoopStart, LoopEnd int
+  
+  // Metadata in JSON format. Same as for PCMAsset plus "stream": true.
+  MetaJSON []byte
+  
+  // Data converted by Samples(), indexed by format.
+  cache map[SoundFormat][]byte
+  mutex sync.Mutex
+}
+
+// Opens the Ogg Vorbis file data for reading. Also returns the loop points from the
+// comments LOOPSTART and LOOPEND or LOOPLENGTH (as used by RPG Maker and others).
+// If there is no LOOPSTART, both are 0. If there is neither LOOPEND nor LOOPLENGTH,
+// the loop extends to the end of the sound.
+func openOgg(data []byte) (r *oggvorbis.Reader, loopstart, loopend int, err error) {
+  r, err = oggvorbis.NewReader(bytes.NewReader(data))
+  if err != nil { return }
+  
+  loopstart, loopend = -1, -1
+  looplength := -1
+  for _, c := range r.CommentHeader().Comments {
+    kv := strings.SplitN(c, "=", 2)
+    if len(kv) != 2 { continue }
+    n, e := strconv.Atoi(strings.TrimSpace(kv[1]))
+    if e != nil { continue }
+    switch strings.ToUpper(kv[0]) {
+      case "LOOPSTART": loopstart = n
+      case "LOOPEND": loopend = n
+      case "LOOPLENGTH": looplength = n
+    }
+  }
+  
+  if loopstart < 0 { return r, 0, 0, nil }
+  if loopend < 0 {
+    if looplength > 0 {
+      loopend = loopstart + looplength
+    } else {
+      loopend = int(r.Length())
+    }
+  }
+  return
+}
+
+// Decodes up to frames sample frames from r.
+func readOgg(r *oggvorbis.Reader, frames int) ([]float32, error) {
+  samples := make([]float32, frames*r.Channels())
+  n := 0
+  for n < len(samples) {
+    k, err := r.Read(samples[n:])
+    n += k
+    if err == io.EOF { break }
+    if err != nil { return nil, err }
+  }
+  return samples[0:n], nil
+}
+
+// Creates and returns a new VorbisAsset,
+//   errorlabel: A label used in error log entries (usually the path of the sound asset)
+//   data: the complete Ogg Vorbis file
+//   freq, channels, layout: the format of the decoded data
+//   frames: the length of the decoded data in sample frames
+//   start, end: the range of sample frames that make up the asset
+//   metadata: optionally a "description" (same syntax as for images) and
+//             "loopstart", "loopend" in sample frames relative to start
+func newVorbisAsset(errorlabel string, data []byte, freq, channels int, layout []speaker, frames, start, end int, metadata map[string]string) SoundAsset {
+  if start < 0 || end < start {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Illegal sample range %v-%v",errorlabel,start,end))
+    return nil
+  }
+  if end > frames {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Sample range %v-%v exceeds sound",errorlabel,start,end))
+    return nil
+  }
+  
+  desc := map[string]string{}
+  for k, v := range metadata { desc[k] = v }
+  desc["description"] = "stream:true\n" + metadata["description"]
+  meta, loopstart, loopend := soundMeta(errorlabel, desc, freq, channels, end-start)
+  if meta == nil { return nil }
+  
+  return &VorbisAsset{Data:data, Freq:freq, Channels:channels, layout:layout, Start:start, End:end, LoopStart:loopstart, LoopEnd:loopend, MetaJSON:meta}
+}
+
+func (a *VorbisAsset) Meta(target interface{}) error {
+  return json.Unmarshal(a.MetaJSON, target)
+}
+
+func (a *VorbisAsset) metaJSON() *[]byte {
+  return &a.MetaJSON
+}
+
+// Decodes the complete asset and converts it. This is not cheap for long sounds, so
+// Stream() should be used for them instead.
+func (a *VorbisAsset) Samples(format SoundFormat) ([]byte,error) {
+  if !format.valid() { return nil, ErrIllFormat }
+  a.mutex.Lock()
+  defer a.mutex.Unlock()
+  if pcm, ok := a.cache[format]; ok { return pcm, nil }
+  
+  r, err := oggvorbis.NewReader(bytes.NewReader(a.Data))
+  if err != nil { return nil, err }
+  err = r.SetPosition(int64(a.Start))
+  if err != nil { return nil, err }
+  data, err := readOgg(r, a.End-a.Start)
+  if err != nil { return nil, err }
+  
+  pcm := convertSamples(data, a.layout, a.Channels, a.Freq, format)
+  if a.cache == nil { a.cache = map[SoundFormat][]byte{} }
+  a.cache[format] = pcm
+  return pcm, nil
+}
@@ -0,0 +1,215 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "sort"
+         "bytes"
+         "sync"
+         "html"
+         "strings"
+         "strconv"
+         "unicode"
+)
+
+// Options that modify how an image is rendered by ImageWith().
+type RenderOptions struct {
+  // Maps layer labels to true (show the layer) or false (hide the layer).
+  // Layers that are not listed keep their visibility from the file.
+  Layers map[string]bool
+  
+  // Maps colors in "#rrggbb" or "#rgb" notation to replacement CSS colors.
+  // Every occurrence of a key color in the SVG source code (e.g. in fill, stroke
+  // or stop-color) is replaced. Case is ignored.
+  Colors map[string]string
+  
+  // CSS custom properties (e.g. "--team") and their values, made available to
+  // the SVG's styles via var(--team). Values must not contain any of "{};<>\\".
+  Properties map[string]string
+  
+  // Maps the ids of <text> and <tspan> elements to their new content and
+  // placeholder names to their replacements. A placeholder is a name in double
+  // braces, e.g. {{label}}, anywhere in the SVG source code. The values are
+  // plain text (i.e. they are escaped as necessary).
+  Text map[string]string
+  
+  // If true, the image is rendered as a nine-slice (see renderNineSlice()) according
+  // to its "slice" metadata.
+  NineSlice bool
+}
+
+// Returns a string that identifies the effect of opt (which may be nil) for
+// the render cache.
+func (opt *RenderOptions) key() string {
+  if opt == nil { return "" }
+  k := []string{}
+  for label, show := range opt.Layers {
+    k = append(k, "L"+strconv.Quote(label)+strconv.FormatBool(show))
+  }
+  for from, to := range opt.Colors {
+    k = append(k, "C"+strconv.Quote(from)+strconv.Quote(to))
+  }
+  for name, value := range opt.Properties {
+    k = append(k, "P"+strconv.Quote(name)+strconv.Quote(value))
+  }
+  for name, value := range opt.Text {
+    k = append(k, "T"+strconv.Quote(name)+strconv.Quote(value))
+  }
+  if opt.NineSlice { k = append(k, "N") }
+  sort.Strings(k)
+  return strings.Join(k, "")
+}
+
+// Returns opt.Colors with the keys normalized to lowercase "#rrggbb".
+func (opt *RenderOptions) colors() (map[string][]byte, error) {
+  colors := map[string][]byte{}
+  for from, to := range opt.Colors {
+    norm, n := normalizeColor([]byte(from))
+    if norm == "" || n != len(from) { return nil, ErrIllColor }
+    colors[norm] = []byte(to)
+  }
+  return colors, nil
+}
+
+// Returns a <style> element that defines opt.Properties for the root element or
+// nil if there are none.
+func (opt *RenderOptions) style() ([]byte, error) {
+  if len(opt.Properties) == 0 { return nil, nil }
+  names := []string{}
+  for name := range opt.Properties {
+    if !strings.HasPrefix(name, "--") || strings.ContainsAny(name, ":;{}<>\\ \t\n") { return nil, ErrIllProperty }
+    // these would end the declaration or the <style> element
+    if strings.ContainsAny(opt.Properties[name], "{};<>\\") { return nil, ErrIllProperty }
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  css := ":root{"
+  for _, name := range names {
+    css += name+":"+opt.Properties[name]+";"
+  }
+  return []byte("<style>"+html.EscapeString(css+"}")+"</style>"), nil
+}
+
+// If color starts with "#" followed by exactly 3 or 6 hex digits that are not
+// followed by another character of a name (so that e.g. "#abcdef" in "#abcdefg",
+// which may be an id reference, is not a color), returns the color in lowercase
+// "#rrggbb" notation and the number of bytes of color it occupies.
+// Otherwise returns "" and 0.
+func normalizeColor(color []byte) (string, int) {
+  if len(color) == 0 || color[0] != '#' { return "", 0 }
+  n := 1
+  for n < len(color) && strings.IndexByte("0123456789abcdefABCDEF", color[n]) >= 0 { n++ }
+  if n < len(color) && (color[n] == '-' || color[n] == '_' || color[n] >= 0x80 || unicode.IsLetter(rune(color[n]))) { return "", 0 }
+  hex := strings.ToLower(string(color[1:n]))
+  if len(hex) == 3 {
+    hex = string([]byte{hex[0],hex[0],hex[1],hex[1],hex[2],hex[2]})
+  } else if len(hex) != 6 {
+    return "", 0
+  }
+  return "#"+hex, n
+}
+
+// Returns a copy of src with all "#rrggbb" and "#rgb" colors found in colors
+// replaced.
+func replaceColors(src []byte, colors map[string][]byte) []byte {
+  res := make([]byte, 0, len(src))
+  for {
+    i := bytes.IndexByte(src, '#')
+    if i < 0 { break }
+    res = append(res, src[0:i]...)
+    src = src[i:]
+    norm, n := normalizeColor(src)
+    if to, ok := colors[norm]; ok && n > 0 {
+      res = append(res, to...)
+      src = src[n:]
+    } else {
+      res = append(res, '#')
+      src = src[1:]
+    }
+  }
+  return append(res, src...)
+}
+
+// Maximum number of images kept in the render cache of ImageWith().
+// 0 disables the cache.
+var RenderCacheSize = 32
+
+type renderKey struct {
+  asset Asset
+  width, height int
+  options string
+}
+
+// An image in the render cache and the data derived from it.
+type renderEntry struct {
+  img []uint32
+  // collision data by threshold, see CollisionData()
+  collision map[uint8]*Collision
+}
+
+// Images rendered by ImageWith() and the order in which they were added.
+var renderCache = map[renderKey]*renderEntry{}
+var renderCacheOrder = []renderKey{}
+var renderCacheMutex sync.Mutex
+
+// Returns a copy of the cached image for key or nil if there is none.
+func cachedImage(key renderKey) []uint32 {
+  renderCacheMutex.Lock()
+  defer renderCacheMutex.Unlock()
+  entry, ok := renderCache[key]
+  if !ok { return nil }
+  return append([]uint32(nil), entry.img...)
+}
+
+// Stores a copy of img in the render cache, evicting the oldest entries if
+// the cache has more than RenderCacheSize entries.
+func cacheImage(key renderKey, img []uint32) {
+  renderCacheMutex.Lock()
+  defer renderCacheMutex.Unlock()
+  if RenderCacheSize <= 0 { return }
+  if _, ok := renderCache[key]; !ok { renderCacheOrder = append(renderCacheOrder, key) }
+  renderCache[key] = &renderEntry{img:append([]uint32(nil), img...)}
+  for len(renderCacheOrder) > RenderCacheSize {
+    delete(renderCache, renderCacheOrder[0])
+    renderCacheOrder = renderCacheOrder[1:]
+  }
+}
+
+// Returns the cached collision data for the image with key and threshold or nil.
+func cachedCollision(key renderKey, threshold uint8) *Collision {
+  renderCacheMutex.Lock()
+  defer renderCacheMutex.Unlock()
+  entry, ok := renderCache[key]
+  if !ok { return nil }
+  return entry.collision[threshold]
+}
+
+// Stores c with the cached image for key (if it is still in the cache).
+func cacheCollision(key renderKey, threshold uint8, c *Collision) {
+  renderCacheMutex.Lock()
+  defer renderCacheMutex.Unlock()
+  entry, ok := renderCache[key]
+  if !ok { return }
+  if entry.collision == nil { entry.collision = map[uint8]*Collision{} }
+  entry.collision[threshold] = c
+}
@@ -0,0 +1,144 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "os"
+         "sort"
+)
+
+// An overlay is a layer of assets (e.g. a mod) that shadows the assets with the
+// same paths in overlays of lower priority.
+type overlay struct {
+  priority int
+  // Order of creation. Breaks ties between overlays with the same priority.
+  seq int
+}
+
+// All overlays by name. Add() adds to the base overlay "".
+var overlays = map[string]*overlay{"": &overlay{}}
+
+// The seq of the most recently created overlay. Never decreases, so that an
+// overlay created after RemoveOverlay() does not get the seq of an existing one.
+var overlaySeq = 0
+
+// The overlay that Add() currently adds to.
+var loadingOverlay = ""
+
+// The key of sourceKeys.
+type sourceID struct {
+  overlay, file string
+}
+
+// Returns true if o shadows o2.
+func (o *overlay) above(o2 *overlay) bool {
+  return o.priority > o2.priority || (o.priority == o2.priority && o.seq > o2.seq)
+}
+
+// Like Add() but adds the assets to the overlay with the given name. Assets in an
+// overlay shadow the assets with the same path in overlays with lower priority
+// (or the same priority, but created earlier). Add() adds to the overlay "", which
+// has priority 0. Shadowing applies to individual assets, so an overlay can replace
+// a single sub-asset of an SVG while the others remain visible.
+// An overlay is created with its first AddOverlay(). Passing a different priority
+// for an existing overlay changes its priority.
+func AddOverlay(name string, priority int, pth string) error {
+  o := overlays[name]
+  if o == nil {
+    overlaySeq++
+    o = &overlay{priority:priority, seq:overlaySeq}
+    overlays[name] = o
+  } else if o.priority != priority {
+    o.priority = priority
+    assets.walk(func(p *pile) { p.update() })
+  }
+  
+  loadingOverlay = name
+  defer func() { loadingOverlay = "" }()
+  return Add(pth)
+}
+
+// Removes all assets (and directory defaults) of the overlay with the given name,
+// so that the assets they shadowed become visible again.
+func RemoveOverlay(name string) {
+  o := overlays[name]
+  if o == nil { return }
+  if name != "" { delete(overlays, name) }
+  assets.walk(func(p *pile) {
+    for i := 0; i < len(p.overlays); i++ {
+      if p.overlays[i].overlay == name {
+        p.overlays = append(p.overlays[:i], p.overlays[i+1:]...)
+        p.update()
+        break
+      }
+    }
+  })
+  for id := range sourceKeys {
+    if id.overlay == name { delete(sourceKeys, id) }
+  }
+}
+
+// Returns the name of the overlay that provides the asset with the given asset_path.
+func Overlay(asset_path string) (string, error) {
+  pil := find(asset_path)
+  if pil == nil { return "", os.ErrNotExist }
+  return pil.overlay, nil
+}
+
+// Stores asset (loaded from file, see put()) and/or (if not nil) defaults (loaded
+// from defaultsFile) for loadingOverlay in p and updates the asset and defaults
+// visible in p.
+// Returns the pile without sub-piles that holds the asset and defaults of loadingOverlay.
+func (p *pile) provide(asset Asset, file, rect string, defaults map[string]interface{}, defaultsFile string) *pile {
+  var o *pile
+  for _, oo := range p.overlays {
+    if oo.overlay == loadingOverlay { o = oo }
+  }
+  if o == nil {
+    o = &pile{path:p.path, overlay:loadingOverlay}
+    p.overlays = append(p.overlays, o)
+  }
+  if asset != nil { o.asset, o.file, o.rect = asset, file, rect }
+  if defaults != nil { o.defaults, o.defaultsFile = defaults, defaultsFile }
+  p.update()
+  return o
+}
+
+// Sorts p.overlays by priority and makes the asset and the defaults of the highest
+// priority overlays that have them p's asset and defaults.
+func (p *pile) update() {
+  sort.SliceStable(p.overlays, func(i, j int) bool {
+    return overlays[p.overlays[j].overlay].above(overlays[p.overlays[i].overlay])
+  })
+  p.asset, p.file, p.rect, p.overlay, p.defaults, p.defaultsFile = nil, "", "", "", nil, ""
+  for _, o := range p.overlays {
+    if o.asset != nil { p.asset, p.file, p.rect, p.overlay = o.asset, o.file, o.rect, o.overlay }
+    if o.defaults != nil { p.defaults, p.defaultsFile = o.defaults, o.defaultsFile }
+  }
+}
+
+// Calls f for p and all piles below it.
+func (p *pile) walk(f func(p *pile)) {
+  f(p)
+  for _, s := range p.sub { s.walk(f) }
+}
@@ -0,0 +1,763 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "io"
+         "os"
+         "fmt"
+         "math"
+         "sort"
+         "path"
+         "bytes"
+         "bufio"
+         "crypto/sha256"
+         "encoding/json"
+         "encoding/binary"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Identifies asset pack files.
+var packMagic = []byte("ASSPACK\n")
+
+// The version of the pack format written by WritePack(). AddPack() rejects packs
+// with a different version.
+const packVersion = 3
+
+// Asset types in pack files.
+const (
+  packSVG = iota+1
+  packRaster
+  packAnimation
+  packPCM
+  packVorbis
+)
+
+// A source file of the assets (or directory defaults) in a pack.
+type packSource struct {
+  file string
+  // The size and modification time of each of sourceFiles(file). size -1 if
+  // the file does not exist (or could not be read when the pack was written).
+  stamps []fileStamp
+  // The hash of the contents of sourceFiles(file).
+  hash [sha256.Size]byte
+}
+
+type fileStamp struct {
+  size, mtime int64
+}
+
+// An overlay of the assets in a pack.
+type packOverlay struct {
+  name string
+  priority int
+}
+
+// Keys for shared slices in packWriter.refs.
+type byteKey struct { p *byte; n int }
+type uint32Key struct { p *uint32; n int }
+type float32Key struct { p *float32; n int }
+
+type packWriter struct {
+  w *bufio.Writer
+  // Objects (assets and shared slices) that have already been written,
+  // mapped to their index.
+  refs map[interface{}]int
+  // Index of each source file.
+  sources map[string]int
+  // Index of each overlay.
+  overlays map[string]int
+  err error
+}
+
+type packReader struct {
+  r *bufio.Reader
+  // Objects (assets and shared slices) read so far by index.
+  objs []interface{}
+  sources []packSource
+  // true for each source whose assets are skipped.
+  stale []bool
+  // true for each skipped source that is to be re-added.
+  readd []bool
+  overlays []packOverlay
+  // The sources to be re-added and the overlays they are re-added to.
+  readds []sourceID
+  err error
+}
+
+// Writes all assets to the pack file file, which can later be loaded with AddPack()
+// much faster than the source files with Add().
+// The source files of the assets are recorded with their size, modification time
+// and SHA-256 hash, so that AddPack() can detect changes.
+// The assets of all overlays are stored (including shadowed ones) together with
+// the names and priorities of their overlays.
+func WritePack(file string) error {
+  f, err := os.Create(file)
+  if err != nil { return err }
+  err = writePack(f, assets, true)
+  if e := f.Close(); err == nil { err = e }
+  if err != nil { os.Remove(file) }
+  return err
+}
+
+// Writes the assets of root and its sub-piles to w in pack format. If withHash is
+// false, the hashes of the source files are not computed (and stored as 0).
+func writePack(w io.Writer, root *pile, withHash bool) error {
+  pw := &packWriter{w:bufio.NewWriter(w), refs:map[interface{}]int{}, sources:map[string]int{}, overlays:map[string]int{}}
+  var sources []packSource
+  var names []string
+  root.walk(func(p *pile) {
+    for _, e := range packEntries(p) {
+      if _, ok := pw.sources[e.file]; e.asset != nil && !ok {
+        pw.sources[e.file] = len(sources)
+        sources = append(sources, statSource(e.file, withHash))
+      }
+      if _, ok := pw.sources[e.defaultsFile]; e.defaults != nil && e.defaultsFile != "" && !ok {
+        pw.sources[e.defaultsFile] = len(sources)
+        sources = append(sources, statSource(e.defaultsFile, withHash))
+      }
+      if _, ok := pw.overlays[e.overlay]; !ok {
+        pw.overlays[e.overlay] = 0
+        names = append(names, e.overlay)
+      }
+    }
+  })
+  // in order of creation, so that AddPack() creates them in the same order
+  sort.Slice(names, func(i, j int) bool { return overlays[names[i]].seq < overlays[names[j]].seq })
+  
+  pw.w.Write(packMagic)
+  pw.uint(packVersion)
+  pw.uint(uint64(len(sources)))
+  for _, s := range sources {
+    pw.string(s.file)
+    pw.uint(uint64(len(s.stamps)))
+    for _, st := range s.stamps {
+      pw.int(st.size)
+      pw.int(st.mtime)
+    }
+    pw.w.Write(s.hash[:])
+  }
+  pw.uint(uint64(len(names)))
+  for i, name := range names {
+    pw.overlays[name] = i
+    pw.string(name)
+    pw.int(int64(overlays[name].priority))
+  }
+  pw.pile(root)
+  
+  if e := pw.w.Flush(); pw.err == nil { pw.err = e }
+  return pw.err
+}
+
+// Returns file and the files whose contents affect the assets loaded from it, i.e.
+// its ".assets" sidecar and its metadata sidecars (see applyMetaSidecars()).
+// A directory defaults file (".assets") has no sidecars.
+func sourceFiles(file string) []string {
+  if path.Base(file) == ".assets" { return []string{file} }
+  files := []string{file, file+".assets"}
+  for _, ext := range metaSidecarExts { files = append(files, file+ext) }
+  return files
+}
+
+// Returns the size and modification time of each of sourceFiles(file) and, if
+// withHash, the SHA-256 hash of their contents.
+func statSource(file string, withHash bool) packSource {
+  src := packSource{file:file}
+  h := sha256.New()
+  for _, f := range sourceFiles(file) {
+    st := fileStamp{size:-1}
+    if fi, err := os.Stat(f); err == nil { st = fileStamp{fi.Size(), fi.ModTime().UnixNano()} }
+    if withHash && st.size >= 0 {
+      data, err := os.ReadFile(f)
+      if err != nil { st.size = -1 }
+      fmt.Fprintf(h, "%v\n", err == nil)
+      hashBytes(h, data)
+    } else {
+      fmt.Fprintf(h, "false\n")
+    }
+    src.stamps = append(src.stamps, st)
+  }
+  if withHash { h.Sum(src.hash[:0]) }
+  return src
+}
+
+// Returns true if the stamps of a and b are equal.
+func equalStamps(a, b packSource) bool {
+  if len(a.stamps) != len(b.stamps) { return false }
+  for i := range a.stamps {
+    if a.stamps[i] != b.stamps[i] { return false }
+  }
+  return true
+}
+
+// Adds all assets from the pack file file written by WritePack() to the overlays
+// they were in. Overlays that do not exist yet are created with the priority they
+// had. As with Add(), assets with the same path as existing ones in the same overlay
+// replace them.
+// If check is true, the source files (including their sidecar files and the
+// directory defaults files) are compared with the pack. Assets whose source
+// file no longer exists are skipped. Source files whose size or modification time
+// (or that of a sidecar) differs are hashed and if their contents have changed, their
+// assets are not taken from the pack but re-added from the source file with Add() (or
+// AddOverlay()). Changed directory defaults files are re-read. This requires the
+// working directory to be the same as when the assets were added for the pack.
+// If the pack is corrupt or has the wrong version, no assets are added and
+// ErrPack is returned.
+func AddPack(file string, check bool) error {
+  f, err := os.Open(file)
+  if err != nil { return err }
+  defer f.Close()
+  
+  root, ovs, stale, err := readPack(f, check)
+  if err != nil { return err }
+  for _, o := range ovs {
+    if overlays[o.name] == nil {
+      overlaySeq++
+      overlays[o.name] = &overlay{priority:o.priority, seq:overlaySeq}
+    }
+  }
+  mergePile(assets, root)
+  
+  for _, id := range stale {
+    var err error
+    if path.Base(id.file) == ".assets" {
+      err = readdDefaults(id)
+    } else {
+      err = AddOverlay(id.overlay, overlays[id.overlay].priority, id.file)
+    }
+    if err != nil { return err }
+  }
+  return nil
+}
+
+// Adds the directory defaults file id.file to the overlay id.overlay.
+func readdDefaults(id sourceID) error {
+  data, err := os.ReadFile(id.file)
+  if err != nil { return err }
+  loadingOverlay = id.overlay
+  defer func() { loadingOverlay = "" }()
+  addDefaults(path.Dir(id.file), data)
+  return nil
+}
+
+// Reads a pack from r and returns its assets in a new pile tree, whose piles hold
+// the assets and defaults of each overlay in p.overlays, and the overlays of the pack.
+// If check is true, assets from changed or missing source files (see AddPack()) are
+// skipped and the changed source files that still exist are returned in stale
+// together with the overlays whose assets they provided.
+func readPack(r io.Reader, check bool) (root *pile, ovs []packOverlay, stale []sourceID, err error) {
+  pr := &packReader{r:bufio.NewReader(r)}
+  magic := make([]byte, len(packMagic))
+  if _, err := io.ReadFull(pr.r, magic); err != nil || !bytes.Equal(magic, packMagic) || pr.uint() != packVersion {
+    return nil, nil, nil, ErrPack
+  }
+  
+  n := pr.uint()
+  for i := uint64(0); i < n && pr.err == nil; i++ {
+    src := packSource{file:pr.string()}
+    for m := pr.count(); m > 0 && pr.err == nil; m-- {
+      src.stamps = append(src.stamps, fileStamp{size:pr.int(), mtime:pr.int()})
+    }
+    pr.read(src.hash[:])
+    changed, readd := false, false
+    if check && pr.err == nil {
+      cur := statSource(src.file, false)
+      if !equalStamps(cur, src) {
+        cur = statSource(src.file, true)
+        changed = cur.stamps[0].size < 0 || cur.hash != src.hash
+        readd = changed && cur.stamps[0].size >= 0
+      }
+    }
+    pr.sources = append(pr.sources, src)
+    pr.stale = append(pr.stale, changed)
+    pr.readd = append(pr.readd, readd)
+  }
+  
+  for n := pr.count(); n > 0 && pr.err == nil; n-- {
+    pr.overlays = append(pr.overlays, packOverlay{name:pr.string(), priority:int(pr.int())})
+  }
+  
+  root = &pile{sub:map[string]*pile{}}
+  pr.pile(root)
+  if pr.err != nil { return nil, nil, nil, ErrPack }
+  return root, pr.overlays, pr.readds, nil
+}
+
+// Moves the assets and defaults of each overlay in src.overlays (see readPack()) and
+// the sub-piles of src into the same overlays of dst. The base overlay "" of src
+// goes into loadingOverlay. The piles that receive an asset are appended to loaded.
+func mergePile(dst, src *pile) {
+  for _, e := range src.overlays {
+    saved := loadingOverlay
+    if e.overlay != "" { loadingOverlay = e.overlay }
+    o := dst.provide(e.asset, e.file, e.rect, e.defaults, e.defaultsFile)
+    loadingOverlay = saved
+    if e.asset != nil { loaded = append(loaded, o) }
+  }
+  for k, s := range src.sub {
+    d := dst.sub[k]
+    if d == nil {
+      d = &pile{sub:map[string]*pile{}, path:s.path}
+      dst.sub[k] = d
+    }
+    mergePile(d, s)
+  }
+}
+
+func (pw *packWriter) uint(x uint64) {
+  var buf [binary.MaxVarintLen64]byte
+  pw.w.Write(buf[0:binary.PutUvarint(buf[:], x)])
+}
+
+func (pw *packWriter) int(x int64) {
+  var buf [binary.MaxVarintLen64]byte
+  pw.w.Write(buf[0:binary.PutVarint(buf[:], x)])
+}
+
+func (pw *packWriter) bytes(b []byte) {
+  pw.uint(uint64(len(b)))
+  pw.w.Write(b)
+}
+
+func (pw *packWriter) string(s string) {
+  pw.uint(uint64(len(s)))
+  pw.w.WriteString(s)
+}
+
+// Writes a reference to the object key, which is either nil (if empty), an object
+// already written or a new object that the caller must write if true is returned.
+func (pw *packWriter) ref(key interface{}, empty bool) bool {
+  if empty { pw.uint(0); return false }
+  if i, ok := pw.refs[key]; ok { pw.uint(uint64(i)+2); return false }
+  pw.refs[key] = len(pw.refs)
+  pw.uint(1)
+  return true
+}
+
+// Writes b, which may be shared with other assets.
+func (pw *packWriter) byteBlob(b []byte) {
+  if len(b) == 0 { pw.ref(nil, true); return }
+  if pw.ref(byteKey{&b[0], len(b)}, false) { pw.bytes(b) }
+}
+
+// Writes u, which may be shared with other assets.
+func (pw *packWriter) uint32Blob(u []uint32) {
+  if len(u) == 0 { pw.ref(nil, true); return }
+  if !pw.ref(uint32Key{&u[0], len(u)}, false) { return }
+  b := make([]byte, 4*len(u))
+  for i, x := range u { binary.LittleEndian.PutUint32(b[4*i:], x) }
+  pw.bytes(b)
+}
+
+// Writes f, which may be shared with other assets.
+func (pw *packWriter) float32Blob(f []float32) {
+  if len(f) == 0 { pw.ref(nil, true); return }
+  if !pw.ref(float32Key{&f[0], len(f)}, false) { return }
+  b := make([]byte, 4*len(f))
+  for i, x := range f { binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x)) }
+  pw.bytes(b)
+}
+
+func (pw *packWriter) layers(l []SVGLayer) {
+  if len(l) == 0 { pw.ref(nil, true); return }
+  if !pw.ref(&l[0], false) { return }
+  pw.uint(uint64(len(l)))
+  for _, l := range l {
+    pw.string(l.Label)
+    pw.int(int64(l.Start))
+    pw.int(int64(l.End))
+    pw.int(int64(l.displayStart))
+    pw.int(int64(l.displayEnd))
+    if l.Hidden { pw.uint(1) } else { pw.uint(0) }
+  }
+}
+
+func (pw *packWriter) texts(t []SVGText) {
+  if len(t) == 0 { pw.ref(nil, true); return }
+  if !pw.ref(&t[0], false) { return }
+  pw.uint(uint64(len(t)))
+  for _, t := range t {
+    pw.string(t.ID)
+    pw.int(int64(t.Start))
+    pw.int(int64(t.End))
+  }
+}
+
+func (pw *packWriter) layout(l []speaker) {
+  pw.uint(uint64(len(l)))
+  for _, s := range l { pw.uint(uint64(s)) }
+}
+
+func (pw *packWriter) asset(a Asset) {
+  if !pw.ref(a, a == nil) { return }
+  switch a := a.(type) {
+    case *SVGAsset:
+      pw.uint(packSVG)
+      pw.byteBlob(a.Head)
+      pw.bytes(a.ViewBox)
+      pw.byteBlob(a.Body)
+      pw.bytes(a.MetaJSON)
+      pw.layers(a.Layers)
+      pw.texts(a.Texts)
+    case *RasterAsset:
+      pw.uint(packRaster)
+      pw.uint32Blob(a.Pixels)
+      pw.int(int64(a.Stride))
+      pw.int(int64(a.Box.X))
+      pw.int(int64(a.Box.Y))
+      pw.int(int64(a.Box.W))
+      pw.int(int64(a.Box.H))
+      pw.int(int64(a.Filter))
+      pw.bytes(a.MetaJSON)
+    case *Animation:
+      pw.uint(packAnimation)
+      pw.uint(uint64(len(a.FrameAssets)))
+      for i := range a.FrameAssets {
+        pw.asset(a.FrameAssets[i])
+        pw.int(int64(a.Durations[i]))
+      }
+      pw.string(a.LoopMode)
+      pw.int(int64(a.LoopCount))
+      pw.bytes(a.MetaJSON)
+    case *PCMAsset:
+      pw.uint(packPCM)
+      pw.float32Blob(a.Data)
+      pw.sound(a.Freq, a.Channels, a.layout, a.Start, a.End, a.LoopStart, a.LoopEnd, a.MetaJSON)
+    case *VorbisAsset:
+      pw.uint(packVorbis)
+      pw.byteBlob(a.Data)
+      pw.sound(a.Freq, a.Channels, a.layout, a.Start, a.End, a.LoopStart, a.LoopEnd, a.MetaJSON)
+    default:
+      if pw.err == nil { pw.err = fmt.Errorf("%T cannot be stored in an asset pack", a) }
+  }
+}
+
+// Writes the fields common to PCMAsset and VorbisAsset.
+func (pw *packWriter) sound(freq, channels int, layout []speaker, start, end, loopstart, loopend int, meta []byte) {
+  for _, x := range []int{freq, channels, start, end, loopstart, loopend} { pw.int(int64(x)) }
+  pw.layout(layout)
+  pw.bytes(meta)
+}
+
+// Returns the piles that hold the assets and defaults of each overlay in p. These are
+// p.overlays, except for piles that are not in the database (see cacheLoaded()),
+// which hold their asset themselves.
+func packEntries(p *pile) []*pile {
+  if len(p.overlays) > 0 || (p.asset == nil && p.defaults == nil) { return p.overlays }
+  return []*pile{p}
+}
+
+// Writes p and its sub-piles (sorted by name).
+func (pw *packWriter) pile(p *pile) {
+  entries := packEntries(p)
+  pw.uint(uint64(len(entries)))
+  for _, e := range entries {
+    pw.uint(uint64(pw.overlays[e.overlay]))
+    pw.asset(e.asset)
+    if e.asset != nil {
+      pw.uint(uint64(pw.sources[e.file]))
+      pw.string(e.rect)
+    }
+    var defaults []byte
+    if e.defaults != nil {
+      var err error
+      defaults, err = json.Marshal(e.defaults)
+      if err != nil && pw.err == nil { pw.err = err }
+    }
+    pw.bytes(defaults)
+    if defaults != nil {
+      // 0 if there is no defaults file
+      if src, ok := pw.sources[e.defaultsFile]; ok && e.defaultsFile != "" {
+        pw.uint(uint64(src)+1)
+      } else {
+        pw.uint(0)
+      }
+    }
+  }
+  
+  names := make([]string, 0, len(p.sub))
+  for k := range p.sub { names = append(names, k) }
+  sort.Strings(names)
+  pw.uint(uint64(len(names)))
+  for _, k := range names {
+    pw.string(k)
+    pw.pile(p.sub[k])
+  }
+}
+
+func (pr *packReader) fail() {
+  if pr.err == nil { pr.err = ErrPack }
+}
+
+func (pr *packReader) uint() uint64 {
+  if pr.err != nil { return 0 }
+  x, err := binary.ReadUvarint(pr.r)
+  if err != nil { pr.fail() }
+  return x
+}
+
+func (pr *packReader) int() int64 {
+  if pr.err != nil { return 0 }
+  x, err := binary.ReadVarint(pr.r)
+  if err != nil { pr.fail() }
+  return x
+}
+
+// Reads a non-negative int.
+func (pr *packReader) count() int {
+  x := pr.uint()
+  if x > math.MaxInt32 { pr.fail(); return 0 }
+  return int(x)
+}
+
+func (pr *packReader) read(b []byte) {
+  if pr.err != nil { return }
+  if _, err := io.ReadFull(pr.r, b); err != nil { pr.fail() }
+}
+
+func (pr *packReader) bytes() []byte {
+  n := pr.count()
+  if pr.err != nil || n == 0 { return nil }
+  // grow b while reading, so a corrupt length does not allocate huge amounts of memory
+  var b bytes.Buffer
+  if m, err := io.CopyN(&b, pr.r, int64(n)); err != nil || m != int64(n) { pr.fail(); return nil }
+  return b.Bytes()
+}
+
+func (pr *packReader) string() string {
+  return string(pr.bytes())
+}
+
+// Reads a reference written by packWriter.ref(). Returns the referenced object
+// (nil if empty or new) and the index the caller must store a new object under
+// (-1 if no new object follows).
+func (pr *packReader) ref() (interface{}, int) {
+  x := pr.uint()
+  switch {
+    case pr.err != nil || x == 0: return nil, -1
+    case x == 1:
+      pr.objs = append(pr.objs, nil)
+      return nil, len(pr.objs)-1
+    case x-2 < uint64(len(pr.objs)): return pr.objs[x-2], -1
+  }
+  pr.fail()
+  return nil, -1
+}
+
+func (pr *packReader) byteBlob() []byte {
+  obj, i := pr.ref()
+  if i < 0 {
+    b, ok := obj.([]byte)
+    if obj != nil && !ok { pr.fail() }
+    return b
+  }
+  b := pr.bytes()
+  pr.objs[i] = b
+  return b
+}
+
+func (pr *packReader) uint32Blob() []uint32 {
+  obj, i := pr.ref()
+  if i < 0 {
+    u, ok := obj.([]uint32)
+    if obj != nil && !ok { pr.fail() }
+    return u
+  }
+  b := pr.bytes()
+  if len(b) % 4 != 0 { pr.fail() }
+  u := make([]uint32, len(b)/4)
+  for i := range u { u[i] = binary.LittleEndian.Uint32(b[4*i:]) }
+  pr.objs[i] = u
+  return u
+}
+
+func (pr *packReader) float32Blob() []float32 {
+  obj, i := pr.ref()
+  if i < 0 {
+    f, ok := obj.([]float32)
+    if obj != nil && !ok { pr.fail() }
+    return f
+  }
+  b := pr.bytes()
+  if len(b) % 4 != 0 { pr.fail() }
+  f := make([]float32, len(b)/4)
+  for i := range f { f[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])) }
+  pr.objs[i] = f
+  return f
+}
+
+func (pr *packReader) layers() []SVGLayer {
+  obj, i := pr.ref()
+  if i < 0 {
+    l, ok := obj.([]SVGLayer)
+    if obj != nil && !ok { pr.fail() }
+    return l
+  }
+  var l []SVGLayer
+  for n := pr.count(); n > 0 && pr.err == nil; n-- {
+    layer := SVGLayer{Label:pr.string(), Start:int(pr.int()), End:int(pr.int()), displayStart:int(pr.int()), displayEnd:int(pr.int())}
+    layer.Hidden = pr.uint() != 0
+    l = append(l, layer)
+  }
+  pr.objs[i] = l
+  return l
+}
+
+func (pr *packReader) texts() []SVGText {
+  obj, i := pr.ref()
+  if i < 0 {
+    t, ok := obj.([]SVGText)
+    if obj != nil && !ok { pr.fail() }
+    return t
+  }
+  var t []SVGText
+  for n := pr.count(); n > 0 && pr.err == nil; n-- {
+    t = append(t, SVGText{ID:pr.string(), Start:int(pr.int()), End:int(pr.int())})
+  }
+  pr.objs[i] = t
+  return t
+}
+
+func (pr *packReader) layout() []speaker {
+  var l []speaker
+  for n := pr.count(); n > 0 && pr.err == nil; n-- {
+    l = append(l, speaker(pr.uint()))
+  }
+  return l
+}
+
+func (pr *packReader) asset() Asset {
+  obj, i := pr.ref()
+  if i < 0 {
+    a, ok := obj.(Asset)
+    if obj != nil && !ok { pr.fail() }
+    return a
+  }
+  var a Asset
+  switch pr.uint() {
+    case packSVG:
+      svg := &SVGAsset{Head:pr.byteBlob(), ViewBox:pr.bytes(), Body:pr.byteBlob(), MetaJSON:pr.bytes(), Layers:pr.layers(), Texts:pr.texts()}
+      inBody := func(start, end int) bool { return start >= 0 && start <= end && end <= len(svg.Body) }
+      for _, l := range svg.Layers {
+        if !inBody(l.Start, l.End) || (l.Hidden && !inBody(l.displayStart, l.displayEnd)) { pr.fail() }
+      }
+      for _, t := range svg.Texts {
+        if !inBody(t.Start, t.End) { pr.fail() }
+      }
+      a = svg
+    case packRaster:
+      r := &RasterAsset{Pixels:pr.uint32Blob(), Stride:int(pr.int())}
+      r.Box = sdl.Rect{X:int32(pr.int()), Y:int32(pr.int()), W:int32(pr.int()), H:int32(pr.int())}
+      r.Filter = Filter(pr.int())
+      r.MetaJSON = pr.bytes()
+      // in int64, so that corrupt values cannot overflow
+      x, y, w, h, stride := int64(r.Box.X), int64(r.Box.Y), int64(r.Box.W), int64(r.Box.H), int64(r.Stride)
+      if x < 0 || y < 0 || w < 0 || h < 0 || stride < 0 || stride > int64(len(r.Pixels)) || x+w > stride || (y+h)*stride > int64(len(r.Pixels)) { pr.fail() }
+      a = r
+    case packAnimation:
+      anim := &Animation{}
+      for n := pr.count(); n > 0 && pr.err == nil; n-- {
+        im, ok := pr.asset().(ImageAsset)
+        if !ok { pr.fail() }
+        anim.FrameAssets = append(anim.FrameAssets, im)
+        anim.Durations = append(anim.Durations, int(pr.int()))
+      }
+      anim.LoopMode = pr.string()
+      anim.LoopCount = int(pr.int())
+      anim.MetaJSON = pr.bytes()
+      a = anim
+    case packPCM:
+      s := &PCMAsset{Data:pr.float32Blob()}
+      pr.sound(&s.Freq, &s.Channels, &s.layout, &s.Start, &s.End, &s.LoopStart, &s.LoopEnd, &s.MetaJSON)
+      if pr.err == nil && s.End > len(s.Data)/s.Channels { pr.fail() }
+      a = s
+    case packVorbis:
+      s := &VorbisAsset{Data:pr.byteBlob()}
+      pr.sound(&s.Freq, &s.Channels, &s.layout, &s.Start, &s.End, &s.LoopStart, &s.LoopEnd, &s.MetaJSON)
+      // End cannot be checked against the length of the stream without decoding it
+      if len(s.Data) == 0 { pr.fail() }
+      a = s
+    default:
+      pr.fail()
+  }
+  pr.objs[i] = a
+  return a
+}
+
+// Reads the fields common to PCMAsset and VorbisAsset.
+func (pr *packReader) sound(freq, channels *int, layout *[]speaker, start, end, loopstart, loopend *int, meta *[]byte) {
+  for _, x := range []*int{freq, channels, start, end, loopstart, loopend} { *x = int(pr.int()) }
+  *layout = pr.layout()
+  *meta = pr.bytes()
+  // WAV files have up to 65535 channels, Ogg Vorbis files up to 255; both store freq as uint32
+  if *freq <= 0 || int64(*freq) > math.MaxUint32 || *channels <= 0 || *channels > math.MaxUint16 || (len(*layout) != 0 && len(*layout) != *channels) {
+    pr.fail()
+  } else if *start < 0 || *end < *start || (*loopend > *loopstart && (*loopstart < 0 || *loopend > *end-*start)) {
+    pr.fail()
+  }
+}
+
+// Reads a pile written by packWriter.pile() into p. Assets from stale sources are skipped.
+func (pr *packReader) pile(p *pile) {
+  for n := pr.count(); n > 0 && pr.err == nil; n-- {
+    ov := pr.count()
+    if ov >= len(pr.overlays) { pr.fail(); return }
+    e := &pile{path:p.path, overlay:pr.overlays[ov].name}
+    if a := pr.asset(); a != nil {
+      src := pr.count()
+      rect := pr.string()
+      if src >= len(pr.sources) { pr.fail(); return }
+      if !pr.stale[src] {
+        e.asset, e.file, e.rect = a, pr.sources[src].file, rect
+      } else if pr.readd[src] {
+        pr.readdSource(sourceID{overlay:e.overlay, file:pr.sources[src].file})
+      }
+    }
+    if defaults := pr.bytes(); defaults != nil {
+      src := pr.count()
+      if src > len(pr.sources) { pr.fail(); return }
+      if src == 0 || !pr.stale[src-1] {
+        if err := json.Unmarshal(defaults, &e.defaults); err != nil { pr.fail() }
+        if src > 0 { e.defaultsFile = pr.sources[src-1].file }
+      } else if pr.readd[src-1] {
+        pr.readdSource(sourceID{overlay:e.overlay, file:pr.sources[src-1].file})
+      }
+    }
+    if e.asset != nil || e.defaults != nil { p.overlays = append(p.overlays, e) }
+  }
+  for n := pr.count(); n > 0 && pr.err == nil; n-- {
+    k := pr.string()
+    s := &pile{sub:map[string]*pile{}, path:path.Join(p.path, k)}
+    p.sub[k] = s
+    pr.pile(s)
+  }
+}
+
+// Appends id to pr.readds if it is not in there, yet.
+func (pr *packReader) readdSource(id sourceID) {
+  for _, r := range pr.readds {
+    if r == id { return }
+  }
+  pr.readds = append(pr.readds, id)
+}
@@ -0,0 +1,133 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "os"
+         "fmt"
+         "math"
+         "strings"
+         "strconv"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Circles and ellipses in the METADATA layer of an SVG file whose radius is at
+// most PointRadius mark points. So do crosshairs, i.e. paths that consist of 2
+// crossing straight lines (see pathCrosshair()).
+var PointRadius = 3.0
+
+// If the <circle> or <ellipse> with the given attributes is small enough to mark a
+// point (see PointRadius), returns its "id" and center as "x" and "y". Otherwise
+// returns nil.
+func svgPoint(attributes map[string]string) map[string]string {
+  r := stringToFloat64(attributes["r"])
+  if math.IsNaN(r) {
+    r = math.Max(stringToFloat64(attributes["rx"]), stringToFloat64(attributes["ry"]))
+  }
+  if math.IsNaN(r) || r > PointRadius { return nil }
+  
+  point := map[string]string{"id":attributes["id"], "x":attributes["cx"], "y":attributes["cy"]}
+  for _, k := range []string{"x","y"} {
+    if point[k] == "" { point[k] = "0" }
+  }
+  return point
+}
+
+// Separates metadata into rectangles, points (entries that have neither "width" nor
+// "height") and collision shapes (entries with "shape").
+func splitMarks(metadata []map[string]string) (rects, points, shapes []map[string]string) {
+  for _, m := range metadata {
+    if m["shape"] != "" {
+      shapes = append(shapes, m)
+    } else if m["width"] == "" && m["height"] == "" {
+      points = append(points, m)
+    } else {
+      rects = append(rects, m)
+    }
+  }
+  return
+}
+
+// Each of the points (with "id", "x" and "y") is assigned to the smallest of the
+// rectangles rects[indexes[...]] that contains it. Its position relative to the
+// rectangle is added to the "points" entry of the rectangle's metadata map in the
+// form "name":{"x":...,"y":...}, separated by commas. The name is the point's id
+// with trailing digits removed.
+// Points that are not contained in any rectangle are added to master (the metadata
+// of the whole-file asset with the rectangle masterbox) instead. If master is nil or
+// the point is outside masterbox, too, the point is logged to ShitLog.
+func applyPoints(pth string, points []map[string]string, metadata []map[string]string, rects []*sdl.Rect, indexes []int, master map[string]string, masterbox *sdl.Rect) {
+  for _, p := range points {
+    x := stringToFloat64(strings.Replace(p["x"],"px","",-1))
+    y := stringToFloat64(strings.Replace(p["y"],"px","",-1))
+    if math.IsNaN(x) || math.IsNaN(y) {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v/%v: Cannot parse coordinates \"%v %v\"",pth,p["id"],p["x"],p["y"]))
+      continue
+    }
+    
+    parent := -1
+    for _, i := range indexes {
+      r := rects[i]
+      if x >= float64(r.X) && x <= float64(r.X+r.W) && y >= float64(r.Y) && y <= float64(r.Y+r.H) &&
+         (parent < 0 || r.W*r.H < rects[parent].W*rects[parent].H) {
+        parent = i
+      }
+    }
+    var meta map[string]string
+    var box *sdl.Rect
+    if parent >= 0 {
+      meta, box = metadata[parent], rects[parent]
+    } else if master != nil && masterbox != nil && x >= float64(masterbox.X) && x <= float64(masterbox.X+masterbox.W) &&
+              y >= float64(masterbox.Y) && y <= float64(masterbox.Y+masterbox.H) {
+      meta, box = master, masterbox
+    } else {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => point %v: Not contained in a rectangle",pth,p["id"]))
+      continue
+    }
+    
+    name := strings.TrimRight(p["id"], "0123456789")
+    if meta["points"] != "" { meta["points"] += "," }
+    meta["points"] += fmt.Sprintf("%v:{\"x\":%v,\"y\":%v}", strconv.Quote(name),
+      strconv.FormatFloat(x-float64(box.X), 'f', -1, 64), strconv.FormatFloat(y-float64(box.Y), 'f', -1, 64))
+  }
+}
+
+// Returns the coordinates of the point with the given name (see Meta() "points") of
+// the image asset with the given asset_path, scaled for rendering the image with
+// the given width*height.
+func Point(asset_path string, name string, width, height int) (x, y float64, err error) {
+  pil := find(asset_path)
+  if pil == nil { return 0, 0, os.ErrNotExist }
+  if _, ok := pil.asset.(ImageAsset); !ok { return 0, 0, ErrAssetType }
+  var meta struct {
+    Width, Height float64
+    Points map[string]struct{ X, Y float64 }
+  }
+  if err = pil.asset.Meta(&meta); err != nil { return 0, 0, err }
+  p, ok := meta.Points[name]
+  if !ok { return 0, 0, ErrPoint }
+  if meta.Width > 0 { x = p.X*float64(width)/meta.Width }
+  if meta.Height > 0 { y = p.Y*float64(height)/meta.Height }
+  return x, y, nil
+}
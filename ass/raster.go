@@ -0,0 +1,290 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "math"
+         "bytes"
+         "image"
+         "encoding/json"
+         "image/draw"
+         _ "image/png"
+         _ "image/jpeg"
+         
+         _ "golang.org/x/image/webp"
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Interpolation filters for rendering raster images at a size different
+// from their native size.
+type Filter int
+
+const (
+  // Use the nearest source pixel. Fast and best for pixel art.
+  FilterNearest Filter = iota
+  // Linear interpolation. When shrinking, all covered source pixels are averaged.
+  FilterBilinear
+  // Lanczos filter with 3 lobes. Slowest but sharpest.
+  FilterLanczos
+)
+
+// The Filter newly added RasterAssets use for Render().
+var DefaultFilter = FilterBilinear
+
+// A rectangular part of a PNG, JPEG or WebP image.
+type RasterAsset struct {
+  // All pixels of the source image in the format returned by Image(), i.e.
+  // pre-multiplied ARGB. Shared by all assets from the same file.
+  Pixels []uint32
+  
+  // Width of the source image, i.e. the number of pixels per row of Pixels.
+  Stride int
+  
+  // The rectangle within the source image that makes up the asset.
+  Box sdl.Rect
+  
+  // The filter used by Render() when scaling.
+  Filter Filter
+  
+  // Metadata in JSON format. Always includes "x","y","width","height","centerx"
+  // and "centery".
+  MetaJSON []byte
+}
+
+// Returns true if ext (which includes the ".") is the extension of a raster image file.
+func isRasterExt(ext string) bool {
+  return ext == ".png" || ext == ".jpg" || ext == ".jpeg" || ext == ".webp"
+}
+
+// Adds a PNG, JPEG or WebP image stored in data to the database with path pth.
+// If sidecar is not nil, it is the contents of the image's ".assets" file that
+// describes sub-assets (see parseSidecar()). Animated PNGs are passed to addAPNG()
+// and do not support sub-assets.
+// Errors are appended to ShitLog.
+func addRaster(pth string, data []byte, sidecar []byte) {
+  if isAPNG(data) {
+    addAPNG(pth, data)
+    return
+  }
+  
+  id := assetID(pth)
+  if id == nil { return }
+  
+  img, _, err := image.Decode(bytes.NewReader(data))
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",pth,err))
+    return
+  }
+  
+  pixels, stride := toARGB(img)
+  box := sdl.Rect{0, 0, int32(stride), int32(len(pixels)/stride)}
+  a := makePile(id)
+  master := map[string]string{"x":"0","y":"0"}
+  if sidecar != nil {
+    addSubAssets(pth, parseSidecar(pth+".assets", sidecar, imageSidecarKeys), a, master, &box, func(errorlabel string, box *sdl.Rect, metadata map[string]string) Asset {
+      return newRasterAsset(errorlabel, pixels, stride, box, metadata)
+    })
+  }
+  a.put(newRasterAsset(pth, pixels, stride, &box, master), "")
+}
+
+// Converts img into pre-multiplied ARGB pixels. Returns the pixels and the width of img.
+func toARGB(img image.Image) ([]uint32, int) {
+  b := img.Bounds()
+  rgba := image.NewRGBA(image.Rect(0,0,b.Dx(),b.Dy()))
+  draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+  pixels := make([]uint32, b.Dx()*b.Dy())
+  for i := range pixels {
+    p := rgba.Pix[i<<2:i<<2+4]
+    pixels[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+  }
+  return pixels, b.Dx()
+}
+
+// Creates and returns a new RasterAsset,
+//   errorlabel: A label used in error log entries (usually the path of the image asset)
+//   pixels, stride: the pre-multiplied ARGB pixels of the source image and its width
+//   box: the rectangle within the source image that describes the asset. Must not
+//        exceed the source image.
+//   metadata: "x" and "y" of the asset and optionally its "description" (see imageMeta())
+//             and "centerx", "centery" relative to box. If the center is missing, the
+//             center of box is used.
+func newRasterAsset(errorlabel string, pixels []uint32, stride int, box *sdl.Rect, metadata map[string]string) ImageAsset {
+  if box.X < 0 || box.Y < 0 || box.W < 0 || box.H < 0 || int(box.X+box.W) > stride || int(box.Y+box.H)*stride > len(pixels) {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Rectangle %v,%v,%v,%v exceeds image",errorlabel,box.X,box.Y,box.W,box.H))
+    return nil
+  }
+  
+  cx := stringToInt32(metadata["centerx"])
+  if cx == -2147483648 { cx = roundint32(float64(box.W)/2) }
+  cy := stringToInt32(metadata["centery"])
+  if cy == -2147483648 { cy = roundint32(float64(box.H)/2) }
+  
+  meta := imageMeta(errorlabel, metadata, box.W, box.H, cx, cy)
+  if meta == nil { return nil }
+  
+  return &RasterAsset{Pixels:pixels, Stride:stride, Box:*box, Filter:DefaultFilter, MetaJSON:meta}
+}
+
+func (a *RasterAsset) Meta(target interface{}) error {
+  return json.Unmarshal(a.MetaJSON, target)
+}
+
+func (a *RasterAsset) metaJSON() *[]byte {
+  return &a.MetaJSON
+}
+
+// Returns the part r of a (see sliceable), which shares a's pixels.
+func (a *RasterAsset) slice(r sdl.Rect) ImageAsset {
+  return &RasterAsset{Pixels:a.Pixels, Stride:a.Stride, Box:sdl.Rect{a.Box.X+r.X, a.Box.Y+r.Y, r.W, r.H}, Filter:a.Filter, MetaJSON:a.MetaJSON}
+}
+
+func (a *RasterAsset) Render(width,height int) ([]uint32,error) {
+  return a.RenderFiltered(width, height, a.Filter)
+}
+
+// Like Render() but uses filter instead of a.Filter.
+func (a *RasterAsset) RenderFiltered(width, height int, filter Filter) ([]uint32,error) {
+  if width <= 0 || height <= 0 { return nil, ErrIllDimensions }
+  data := make([]uint32, width*height)
+  if a.Box.W == 0 || a.Box.H == 0 { return data, nil }
+  
+  if filter == FilterNearest {
+    for y := 0; y < height; y++ {
+      sy := int(a.Box.Y) + (2*y+1)*int(a.Box.H)/(2*height)
+      row := a.Pixels[sy*a.Stride:]
+      for x := 0; x < width; x++ {
+        data[y*width+x] = row[int(a.Box.X) + (2*x+1)*int(a.Box.W)/(2*width)]
+      }
+    }
+    return data, nil
+  }
+  
+  k := triangle
+  if filter == FilterLanczos { k = lanczos3 }
+  
+  // horizontal pass: a.Box.H rows of width pixels with 4 channels (A,R,G,B) each
+  xstart, xweights := filterWeights(int(a.Box.W), width, k)
+  tmp := make([]float32, int(a.Box.H)*width*4)
+  for y := 0; y < int(a.Box.H); y++ {
+    row := a.Pixels[(int(a.Box.Y)+y)*a.Stride+int(a.Box.X):]
+    t := tmp[y*width*4:]
+    for x := 0; x < width; x++ {
+      var ch [4]float32
+      for i, w := range xweights[x] {
+        p := row[xstart[x]+i]
+        ch[0] += w*float32(p>>24)
+        ch[1] += w*float32((p>>16)&0xff)
+        ch[2] += w*float32((p>>8)&0xff)
+        ch[3] += w*float32(p&0xff)
+      }
+      copy(t[x*4:], ch[:])
+    }
+  }
+  
+  // vertical pass
+  ystart, yweights := filterWeights(int(a.Box.H), height, k)
+  for y := 0; y < height; y++ {
+    for x := 0; x < width; x++ {
+      var ch [4]float32
+      for i, w := range yweights[y] {
+        t := tmp[((ystart[y]+i)*width+x)*4:]
+        ch[0] += w*t[0]
+        ch[1] += w*t[1]
+        ch[2] += w*t[2]
+        ch[3] += w*t[3]
+      }
+      // Filters with negative lobes may produce values outside the valid range.
+      // Colors are pre-multiplied, so they must not exceed alpha.
+      alpha := clamp(ch[0], 255)
+      data[y*width+x] = alpha<<24 | clamp(ch[1],alpha)<<16 | clamp(ch[2],alpha)<<8 | clamp(ch[3],alpha)
+    }
+  }
+  
+  return data, nil
+}
+
+// A resampling filter.
+type filterKernel struct {
+  // f(x) is 0 for |x| >= support
+  support float64
+  f func(x float64) float64
+}
+
+var triangle = filterKernel{1, func(x float64) float64 {
+  x = math.Abs(x)
+  if x >= 1 { return 0 }
+  return 1-x
+}}
+
+var lanczos3 = filterKernel{3, func(x float64) float64 {
+  if x == 0 { return 1 }
+  if x <= -3 || x >= 3 { return 0 }
+  x *= math.Pi
+  return 3*math.Sin(x)*math.Sin(x/3)/(x*x)
+}}
+
+// Computes for each of dstlen destination pixels the index of the first source pixel
+// (out of srclen) that contributes to it and the normalized weights of that pixel and
+// the following ones.
+func filterWeights(srclen, dstlen int, k filterKernel) (start []int, weights [][]float32) {
+  start = make([]int, dstlen)
+  weights = make([][]float32, dstlen)
+  scale := float64(srclen)/float64(dstlen)
+  // when shrinking, the filter is widened so that every source pixel contributes
+  fscale := math.Max(scale, 1)
+  support := k.support*fscale
+  for i := range start {
+    center := (float64(i)+0.5)*scale
+    lo := int(math.Floor(center-support))
+    if lo < 0 { lo = 0 }
+    hi := int(math.Ceil(center+support))
+    if hi > srclen { hi = srclen }
+    w := make([]float32, hi-lo)
+    var sum float64
+    for j := range w {
+      v := k.f((float64(lo+j)+0.5-center)/fscale)
+      w[j] = float32(v)
+      sum += v
+    }
+    if sum == 0 { // cannot happen with the above filters, but just in case
+      lo = int(center)
+      if lo >= srclen { lo = srclen-1 }
+      w = []float32{1}
+    } else {
+      for j := range w { w[j] = float32(float64(w[j])/sum) }
+    }
+    start[i] = lo
+    weights[i] = w
+  }
+  return
+}
+
+// Rounds f and clamps it to the range 0..max.
+func clamp(f float32, max uint32) uint32 {
+  if f <= 0 { return 0 }
+  u := uint32(f+0.5)
+  if u > max { return max }
+  return u
+}
@@ -0,0 +1,183 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "sort"
+         "path"
+         "math"
+         "reflect"
+         "strings"
+)
+
+// Describes the metadata required for assets. Maps metadata keys to their type:
+// "number", "integer", "string", "bool", "array", "object" or "any". A "?" suffix
+// (e.g. "number?") makes a key optional. Keys that are neither in the schema nor
+// generated by assman (like "width" or the document metadata "license") are errors,
+// unless the schema has the key "*", whose type then applies to all such keys.
+type Schema map[string]string
+
+type schemaEntry struct {
+  pattern string
+  schema Schema
+}
+
+// The schemas registered with RegisterSchema().
+var schemas []schemaEntry
+
+// The metadata keys that assman generates.
+var generatedMetaKeys = map[string]bool{
+  "x":true, "y":true, "width":true, "height":true, "centerx":true, "centery":true,
+  "slice":true, "points":true, "shapes":true,
+  "frames":true, "durations":true, "totalduration":true, "loop":true, "loopcount":true,
+  "duration":true, "channels":true, "samplerate":true, "loopstart":true, "loopend":true, "stream":true,
+}
+
+// Registers schema for the assets whose paths match pattern. The components of
+// pattern are matched with path.Match() against those of the asset path, except for
+// "**", which matches any number of components (including 0), e.g. "enemies/**".
+// Assets added by Add() after registration are validated against all schemas whose
+// pattern matches. Violations are appended to ShitLog.
+func RegisterSchema(pattern string, schema Schema) {
+  schemas = append(schemas, schemaEntry{strings.ToLower(strings.Trim(pattern, "/")), schema})
+}
+
+// Returns a Schema for the JSON representation of the struct v (or pointer to one).
+// The keys are the names from the fields' json tags or the lowercase field names.
+// Fields with the "omitempty" option and pointer fields are optional.
+func SchemaOf(v interface{}) Schema {
+  t := reflect.TypeOf(v)
+  for t.Kind() == reflect.Ptr { t = t.Elem() }
+  schema := Schema{}
+  if t.Kind() != reflect.Struct { return schema }
+  for i := 0; i < t.NumField(); i++ {
+    f := t.Field(i)
+    if f.PkgPath != "" { continue } // unexported
+    tag := strings.Split(f.Tag.Get("json"), ",")
+    if tag[0] == "-" { continue }
+    name := tag[0]
+    if name == "" { name = strings.ToLower(f.Name) }
+    optional := ""
+    for _, opt := range tag[1:] {
+      if opt == "omitempty" { optional = "?" }
+    }
+    ft := f.Type
+    if ft.Kind() == reflect.Ptr {
+      optional = "?"
+      ft = ft.Elem()
+    }
+    typ := "any"
+    switch ft.Kind() {
+      case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+           reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64: typ = "integer"
+      case reflect.Float32, reflect.Float64: typ = "number"
+      case reflect.String: typ = "string"
+      case reflect.Bool: typ = "bool"
+      case reflect.Slice, reflect.Array: typ = "array"
+      case reflect.Map, reflect.Struct: typ = "object"
+    }
+    schema[name] = typ+optional
+  }
+  return schema
+}
+
+// Returns true if the asset path pth matches pattern (see RegisterSchema()).
+func matchPattern(pattern, pth string) bool {
+  return matchComponents(strings.Split(pattern, "/"), strings.Split(pth, "/"))
+}
+
+func matchComponents(pattern, pth []string) bool {
+  if len(pattern) == 0 { return len(pth) == 0 }
+  if pattern[0] == "**" {
+    for i := 0; i <= len(pth); i++ {
+      if matchComponents(pattern[1:], pth[i:]) { return true }
+    }
+    return false
+  }
+  if len(pth) == 0 { return false }
+  if ok, err := path.Match(pattern[0], pth[0]); !ok || err != nil { return false }
+  return matchComponents(pattern[1:], pth[1:])
+}
+
+// Returns true if value (as produced by json.Unmarshal into interface{}) has type typ
+// (see Schema).
+func hasType(value interface{}, typ string) bool {
+  switch value.(type) {
+    case float64:
+      return typ == "number" || typ == "any" || (typ == "integer" && value.(float64) == math.Trunc(value.(float64)))
+    case string: return typ == "string" || typ == "any"
+    case bool: return typ == "bool" || typ == "any"
+    case []interface{}: return typ == "array" || typ == "any"
+    case map[string]interface{}: return typ == "object" || typ == "any"
+  }
+  return typ == "any" // null
+}
+
+// Validates the assets of piles against the registered schemas. Violations are
+// appended to ShitLog.
+func validate(piles []*pile) {
+  for _, p := range piles {
+    var meta map[string]interface{}
+    metaloaded := false
+    for _, s := range schemas {
+      if !matchPattern(s.pattern, p.path) { continue }
+      if !metaloaded {
+        metaloaded = true
+        if err := p.meta(&meta); err != nil {
+          ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",p.source(),err))
+          break
+        }
+      }
+      for _, msg := range s.schema.check(meta) {
+        ShitLog = append(ShitLog, fmt.Sprintf("%v: %v (asset %v)",p.source(),msg,p.path))
+      }
+    }
+  }
+}
+
+// Returns a description of each violation of schema by meta, sorted by key.
+func (schema Schema) check(meta map[string]interface{}) []string {
+  msgs := []string{}
+  for key, typ := range schema {
+    if key == "*" { continue }
+    optional := strings.HasSuffix(typ, "?")
+    typ = strings.TrimSuffix(typ, "?")
+    value, ok := meta[key]
+    if !ok {
+      if !optional { msgs = append(msgs, fmt.Sprintf("Missing %v \"%v\"",typ,key)) }
+    } else if !hasType(value, typ) {
+      msgs = append(msgs, fmt.Sprintf("\"%v\" must be of type %v",key,typ))
+    }
+  }
+  for key, value := range meta {
+    if _, ok := schema[key]; ok || generatedMetaKeys[key] || documentMetaKeys[key] { continue }
+    if typ, ok := schema["*"]; !ok {
+      msgs = append(msgs, fmt.Sprintf("Unknown key \"%v\"",key))
+    } else if typ = strings.TrimSuffix(typ, "?"); !hasType(value, typ) {
+      msgs = append(msgs, fmt.Sprintf("\"%v\" must be of type %v",key,typ))
+    }
+  }
+  sort.Strings(msgs)
+  return msgs
+}
@@ -0,0 +1,275 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "math"
+         "strings"
+         "strconv"
+         
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Returns true if the SVG element tagname in the METADATA layer marks a point or a
+// collision shape.
+func isMarkTag(tagname string) bool {
+  return tagname == "circle" || tagname == "ellipse" || tagname == "polygon" || tagname == "path"
+}
+
+// Converts the <circle>, <ellipse>, <polygon> or <path> (see isMarkTag()) with the
+// given attributes into a point (see svgPoint() and pathCrosshair()) or a collision
+// shape. A collision
+// shape has the keys "id", "type" (the element's label or its id without trailing
+// digits), "shape" ("circle", "ellipse" or "polygon"), "cx", "cy", "r" (for circles),
+// "rx", "ry" (for ellipses) and "points" (for polygons, the coordinates separated
+// by spaces). Paths are converted to polygons unless they are Inkscape arcs or
+// crosshairs.
+// Returns nil if the element cannot be converted. Errors are appended to ShitLog.
+func svgMark(pth string, tagname string, attributes map[string]string) map[string]string {
+  if tagname == "path" {
+    if x, y, ok := pathCrosshair(attributes["d"]); ok {
+      return map[string]string{"id":attributes["id"], "x":strconv.FormatFloat(x, 'f', -1, 64), "y":strconv.FormatFloat(y, 'f', -1, 64)}
+    }
+  }
+  if tagname == "path" && attributes["type"] == "arc" { // sodipodi:type="arc" with sodipodi:cx,...
+    tagname = "ellipse"
+  }
+  if tagname == "circle" || tagname == "ellipse" {
+    if point := svgPoint(attributes); point != nil { return point }
+  }
+  
+  shape := map[string]string{"id":attributes["id"], "type":attributes["label"], "shape":tagname}
+  if shape["type"] == "" { shape["type"] = strings.TrimRight(attributes["id"], "0123456789") }
+  for _, k := range []string{"cx","cy","r","rx","ry","points"} {
+    shape[k] = attributes[k]
+  }
+  for _, k := range []string{"cx","cy"} {
+    if shape[k] == "" { shape[k] = "0" }
+  }
+  
+  if tagname == "ellipse" && attributes["rx"] == attributes["ry"] {
+    shape["shape"] = "circle"
+    shape["r"] = attributes["rx"]
+  } else if tagname == "path" {
+    poly := pathPolygon(attributes["d"])
+    if poly == nil {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => path %v: Only crosshairs and paths with a single subpath of straight lines are supported",pth,attributes["id"]))
+      return nil
+    }
+    shape["shape"] = "polygon"
+    shape["points"] = formatFloats(poly)
+  }
+  return shape
+}
+
+// Returns the numbers of list (separated by whitespace and/or commas) or nil if
+// list contains something else.
+func parseFloats(list string) []float64 {
+  f := strings.Fields(strings.Replace(list, ",", " ", -1))
+  res := make([]float64, len(f))
+  for i := range f {
+    res[i] = stringToFloat64(f[i])
+    if math.IsNaN(res[i]) { return nil }
+  }
+  return res
+}
+
+// Returns nums formatted as a space-separated list.
+func formatFloats(nums []float64) string {
+  s := make([]string, len(nums))
+  for i := range nums {
+    s[i] = strconv.FormatFloat(nums[i], 'f', -1, 64)
+  }
+  return strings.Join(s, " ")
+}
+
+// Converts the SVG path data d into the coordinates x1,y1,x2,y2,... of its corners.
+// Returns nil if d contains anything but a single subpath made with the commands
+// M, L, H, V, Z (and their relative variants).
+func pathPolygon(d string) []float64 {
+  subpaths := pathSubpaths(d)
+  if len(subpaths) != 1 || len(subpaths[0]) < 6 { return nil }
+  return subpaths[0]
+}
+
+// If the SVG path data d consists of 2 straight lines that cross (each a subpath
+// with 2 points), returns the intersection and true.
+func pathCrosshair(d string) (x, y float64, ok bool) {
+  subpaths := pathSubpaths(d)
+  if len(subpaths) != 2 || len(subpaths[0]) != 4 || len(subpaths[1]) != 4 { return 0, 0, false }
+  a, b := subpaths[0], subpaths[1]
+  rx, ry := a[2]-a[0], a[3]-a[1]
+  sx, sy := b[2]-b[0], b[3]-b[1]
+  denom := rx*sy-ry*sx
+  if denom == 0 { return 0, 0, false } // parallel
+  qx, qy := b[0]-a[0], b[1]-a[1]
+  t := (qx*sy-qy*sx)/denom
+  u := (qx*ry-qy*rx)/denom
+  if t < 0 || t > 1 || u < 0 || u > 1 { return 0, 0, false }
+  return a[0]+t*rx, a[1]+t*ry, true
+}
+
+// Converts the SVG path data d into the corner coordinates x1,y1,x2,y2,... of each
+// of its subpaths. Returns nil if d contains anything but straight lines made with
+// the commands M, L, H, V, Z (and their relative variants).
+func pathSubpaths(d string) [][]float64 {
+  // split into commands and numbers
+  tokens := []string{}
+  for i := 0; i < len(d); {
+    c := d[i]
+    if c == ' ' || c == ',' || c == '\t' || c == '\n' || c == '\r' {
+      i++
+    } else if strings.IndexByte("MmLlHhVvZz", c) >= 0 {
+      tokens = append(tokens, d[i:i+1])
+      i++
+    } else if strings.IndexByte("+-.0123456789", c) >= 0 {
+      j := i+1
+      dot := c == '.'
+      for j < len(d) {
+        if d[j] == '.' && !dot {
+          dot = true
+        } else if (d[j] == 'e' || d[j] == 'E') && j+1 < len(d) {
+          j++ // skip sign of exponent
+          dot = true
+        } else if d[j] < '0' || d[j] > '9' {
+          break
+        }
+        j++
+      }
+      tokens = append(tokens, d[i:j])
+      i = j
+    } else {
+      return nil
+    }
+  }
+  
+  subpaths := [][]float64{}
+  var x, y float64
+  cmd := ""
+  closed := false
+  for i := 0; i < len(tokens); {
+    if c := tokens[i][0]; c >= 'A' {
+      cmd = tokens[i]
+      i++
+      if cmd == "M" || cmd == "m" {
+        subpaths = append(subpaths, []float64{})
+        closed = false
+      }
+      if (cmd == "Z" || cmd == "z") && len(subpaths) > 0 {
+        closed = true
+        if sub := subpaths[len(subpaths)-1]; len(sub) >= 2 { x, y = sub[0], sub[1] }
+      }
+      continue
+    }
+    if closed || len(subpaths) == 0 { return nil }
+    
+    n := 2
+    if cmd == "H" || cmd == "h" || cmd == "V" || cmd == "v" { n = 1 }
+    if i+n > len(tokens) { return nil }
+    args := parseFloats(strings.Join(tokens[i:i+n], " "))
+    if len(args) != n { return nil }
+    i += n
+    
+    switch cmd {
+      case "M", "L": x, y = args[0], args[1]
+      case "m", "l": x, y = x+args[0], y+args[1]
+      case "H": x = args[0]
+      case "h": x += args[0]
+      case "V": y = args[0]
+      case "v": y += args[0]
+    }
+    // coordinates after M/m are implicit L/l
+    if cmd == "M" { cmd = "L" }
+    if cmd == "m" { cmd = "l" }
+    subpaths[len(subpaths)-1] = append(subpaths[len(subpaths)-1], x, y)
+  }
+  return subpaths
+}
+
+// Each of the collision shapes (see svgMark()) is assigned to the smallest of the
+// rectangles rects[indexes[...]] that contains its bounding box (or if there is
+// none, its center). Its JSON representation with coordinates relative to the
+// rectangle is added to the "shapes" entry of the rectangle's metadata map,
+// separated by commas.
+// Shapes that are not contained in any rectangle are logged to ShitLog.
+func applyShapes(pth string, shapes []map[string]string, metadata []map[string]string, rects []*sdl.Rect, indexes []int) {
+  for _, s := range shapes {
+    var coords []float64 // x1,y1,x2,y2,... (absolute) for polygons, cx,cy otherwise
+    var radii []float64 // r or rx,ry
+    switch s["shape"] {
+      case "circle": coords, radii = parseFloats(s["cx"]+" "+s["cy"]), parseFloats(s["r"]+" "+s["r"])
+      case "ellipse": coords, radii = parseFloats(s["cx"]+" "+s["cy"]), parseFloats(s["rx"]+" "+s["ry"])
+      default: coords, radii = parseFloats(s["points"]), []float64{0,0}
+    }
+    if len(coords) < 2 || len(coords)%2 != 0 || len(radii) != 2 || radii[0] < 0 || radii[1] < 0 {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => %v %v: Cannot parse coordinates",pth,s["shape"],s["id"]))
+      continue
+    }
+    
+    // bounding box
+    minx, miny, maxx, maxy := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+    for i := 0; i < len(coords); i += 2 {
+      minx, maxx = math.Min(minx, coords[i]-radii[0]), math.Max(maxx, coords[i]+radii[0])
+      miny, maxy = math.Min(miny, coords[i+1]-radii[1]), math.Max(maxy, coords[i+1]+radii[1])
+    }
+    
+    parent := -1
+    for _, contain := range []bool{true, false} {
+      for _, i := range indexes {
+        r := rects[i]
+        x1, y1, x2, y2 := float64(r.X), float64(r.Y), float64(r.X+r.W), float64(r.Y+r.H)
+        inside := (minx >= x1 && maxx <= x2 && miny >= y1 && maxy <= y2)
+        if !contain { // center
+          cx, cy := (minx+maxx)/2, (miny+maxy)/2
+          inside = (cx >= x1 && cx <= x2 && cy >= y1 && cy <= y2)
+        }
+        if inside && (parent < 0 || r.W*r.H < rects[parent].W*rects[parent].H) { parent = i }
+      }
+      if parent >= 0 { break }
+    }
+    if parent < 0 {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v => %v %v: Not contained in a rectangle",pth,s["shape"],s["id"]))
+      continue
+    }
+    
+    for i := 0; i < len(coords); i += 2 {
+      coords[i] -= float64(rects[parent].X)
+      coords[i+1] -= float64(rects[parent].Y)
+    }
+    
+    json := fmt.Sprintf("{\"type\":%v,\"shape\":%v,", strconv.Quote(s["type"]), strconv.Quote(s["shape"]))
+    switch s["shape"] {
+      case "circle": json += fmt.Sprintf("\"x\":%v,\"y\":%v,\"r\":%v}", coords[0], coords[1], radii[0])
+      case "ellipse": json += fmt.Sprintf("\"x\":%v,\"y\":%v,\"rx\":%v,\"ry\":%v}", coords[0], coords[1], radii[0], radii[1])
+      default:
+        pairs := make([]string, 0, len(coords)/2)
+        for i := 0; i < len(coords); i += 2 {
+          pairs = append(pairs, fmt.Sprintf("[%v,%v]", coords[i], coords[i+1]))
+        }
+        json += fmt.Sprintf("\"points\":[%v]}", strings.Join(pairs, ","))
+    }
+    if metadata[parent]["shapes"] != "" { metadata[parent]["shapes"] += "," }
+    metadata[parent]["shapes"] += json
+  }
+}
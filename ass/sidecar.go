@@ -0,0 +1,88 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "sort"
+         "strconv"
+         "encoding/json"
+         
+         "github.com/mbenkmann/golib/util"
+)
+
+// The built-in keys of a sidecar entry for a raster image.
+var imageSidecarKeys = map[string]bool{"x":true, "y":true, "width":true, "height":true, "centerx":true, "centery":true}
+
+// The built-in keys of a sidecar entry for a sound.
+var soundSidecarKeys = map[string]bool{"start":true, "end":true, "loopstart":true, "loopend":true}
+
+// Parses the contents of a ".assets" sidecar file which uses the same syntax as
+// descriptions in SVG files (see README). Each top-level key is the id of a sub-asset
+// and its value is an object. The keys in builtin must have numeric values and describe
+// the sub-asset's position within the main asset (e.g. the keys "x", "y", "width",
+// "height" of imageSidecarKeys). All other keys are custom metadata of the sub-asset.
+//
+// The result has one map per sub-asset with its "id", the builtin keys and the
+// custom metadata encoded as "description". Errors are appended to ShitLog (errorlabel
+// is used as prefix) and the offending entries are skipped.
+func parseSidecar(errorlabel string, sidecar []byte, builtin map[string]bool) []map[string]string {
+  entries := map[string]map[string]interface{}{}
+  err := json.Unmarshal(util.AlmostJSON(string(sidecar)), &entries)
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",errorlabel,err))
+    return nil
+  }
+  
+  ids := make([]string, 0, len(entries))
+  for id := range entries { ids = append(ids, id) }
+  sort.Strings(ids) // for deterministic order of error messages
+  
+  metadata := make([]map[string]string, 0, len(entries))
+  for _, id := range ids {
+    m := map[string]string{"id":id}
+    desc := []byte{}
+    for k, v := range entries[id] {
+      if builtin[k] {
+        f, ok := v.(float64)
+        if !ok {
+          ShitLog = append(ShitLog, fmt.Sprintf("%v: %v: \"%v\" must be a number",errorlabel,id,k))
+          m = nil
+          break
+        }
+        m[k] = strconv.FormatFloat(f, 'f', -1, 64)
+      } else {
+        js, _ := json.Marshal(v)
+        desc = append(desc, strconv.Quote(k)...)
+        desc = append(desc, ':')
+        desc = append(desc, js...)
+        desc = append(desc, '\n')
+      }
+    }
+    if m != nil {
+      m["description"] = string(desc)
+      metadata = append(metadata, m)
+    }
+  }
+  return metadata
+}
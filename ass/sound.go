@@ -0,0 +1,277 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "sync"
+         "strconv"
+         "encoding/json"
+         
+         "github.com/jfreymuth/oggvorbis"
+         "github.com/veandco/go-sdl2/sdl"
+         "github.com/mbenkmann/golib/util"
+)
+
+// The type of the individual samples of PCM data.
+type SampleType int
+
+const (
+  // Signed 16 bit integers, native endian.
+  SampleInt16 SampleType = iota
+  // 32 bit floating point numbers in the range -1.0 to 1.0, native endian.
+  SampleFloat32
+)
+
+// Describes the layout of PCM data.
+type SoundFormat struct {
+  // Sample frames per second, e.g. 44100.
+  Freq int
+  // Number of channels, e.g. 2 for stereo. The samples of the channels are
+  // interleaved, i.e. stereo data is stored LRLRLR...
+  Channels int
+  // Type of the individual samples.
+  Type SampleType
+}
+
+// Returns true if f describes a format supported by Sound().
+func (f SoundFormat) valid() bool {
+  return f.Freq > 0 && f.Channels > 0 && (f.Type == SampleInt16 || f.Type == SampleFloat32)
+}
+
+// Returns the number of bytes of one sample frame in format f.
+func (f SoundFormat) frameSize() int {
+  if f.Type == SampleFloat32 { return 4*f.Channels }
+  return 2*f.Channels
+}
+
+// Superinterface of all sound assets.
+type SoundAsset interface{
+  Asset
+  // Returns the sound's PCM data converted to format. Implementations may cache the
+  // result, so the returned slice must not be modified.
+  Samples(format SoundFormat) ([]byte,error)
+}
+
+// A sound (or a part of one) that has been decoded into memory.
+type PCMAsset struct {
+  // Interleaved samples of the complete source file in the range -1.0 to 1.0.
+  // Shared by all assets from the same file.
+  Data []float32
+  
+  // Sample frames per second of Data.
+  Freq int
+  
+  // Number of channels of Data.
+  Channels int
+  
+  // The speaker position of each channel of Data. nil if unknown.
+  layout []speaker
+  
+  // The sample frames (not samples) Data[Start*Channels:End*Channels] make up the asset.
+  Start, End int
+  
+  // Loop points in sample frames relative to Start. LoopEnd is exclusive.
+  // If LoopEnd <= LoopStart, the sound has no loop.
+  LoopStart, LoopEnd int
+  
+  // Metadata in JSON format. Always includes "duration" (in seconds), "frames"
+  // (the number of sample frames), "channels" and "samplerate" (the Freq of the
+  // original data). If the sound has a loop, "loopstart" and "loopend" are
+  // included (same as LoopStart and LoopEnd).
+  MetaJSON []byte
+  
+  // Data converted by Samples(), indexed by format.
+  cache map[SoundFormat][]byte
+  mutex sync.Mutex
+}
+
+// Returns true if ext (which includes the ".") is the extension of a sound file.
+func isSoundExt(ext string) bool {
+  return ext == ".wav" || ext == ".ogg"
+}
+
+// Adds a WAV (if ext is ".wav") or Ogg Vorbis sound file stored in data to the
+// database with path pth.
+// Labeled cue points of WAV files and the entries of sidecar (if not nil), which is
+// the contents of the sound's ".assets" file, become sub-assets. They share the
+// sample data of the main asset.
+// Ogg files longer than StreamThreshold are not decoded but stored as VorbisAssets.
+// Errors are appended to ShitLog.
+func addSound(pth string, ext string, data []byte, sidecar []byte) {
+  id := assetID(pth)
+  if id == nil { return }
+  
+  var samples []float32
+  var freq, channels, frames int
+  var layout []speaker
+  var info wavInfo
+  var err error
+  streamed := false
+  if ext == ".wav" {
+    samples, freq, channels, info, err = decodeWAV(data)
+    layout = maskLayout(info.mask, channels)
+    if channels > 0 { frames = len(samples)/channels }
+  } else {
+    var r *oggvorbis.Reader
+    r, info.loopStart, info.loopEnd, err = openOgg(data)
+    if err == nil {
+      freq, channels, frames = r.SampleRate(), r.Channels(), int(r.Length())
+      layout = layoutFor(vorbisLayouts, channels)
+      streamed = freq > 0 && float64(frames)/float64(freq) > StreamThreshold
+      if !streamed {
+        samples, err = readOgg(r, frames)
+        if channels > 0 { frames = len(samples)/channels }
+      }
+    }
+  }
+  for _, w := range info.warnings {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",pth,w))
+  }
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: %v",pth,err))
+    return
+  }
+  if freq <= 0 || channels <= 0 {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Illegal sample rate %v or number of channels %v",pth,freq,channels))
+    return
+  }
+  
+  newSound := func(errorlabel string, start, end int, metadata map[string]string) SoundAsset {
+    if streamed {
+      return newVorbisAsset(errorlabel, data, freq, channels, layout, frames, start, end, metadata)
+    }
+    return newPCMAsset(errorlabel, samples, freq, channels, layout, start, end, metadata)
+  }
+  
+  a := makePile(id)
+  master := map[string]string{}
+  if info.loopEnd > info.loopStart {
+    master["loopstart"] = strconv.Itoa(info.loopStart)
+    master["loopend"] = strconv.Itoa(info.loopEnd)
+  }
+  a.put(newSound(pth, 0, frames, master), "")
+  
+  regions := info.regions
+  if sidecar != nil {
+    regions = append(regions, parseSidecar(pth+".assets", sidecar, soundSidecarKeys)...)
+  }
+  addSubAssets(pth, regionRects(pth, regions), a, nil, nil, func(errorlabel string, box *sdl.Rect, metadata map[string]string) Asset {
+    start := int(box.X)
+    // loop points of regions are absolute, but relative to the sub-asset in the result
+    for _, k := range []string{"loopstart","loopend"} {
+      if pos, err := strconv.Atoi(metadata[k]); err == nil {
+        metadata[k] = strconv.Itoa(pos-start)
+      }
+    }
+    return newSound(errorlabel, start, start+int(box.W), metadata)
+  })
+}
+
+// Converts the "start" and "end" of regions (in the format returned by parseSidecar()
+// with soundSidecarKeys) into rectangles of height 1 suitable for addSubAssets().
+// Regions without valid "start" and "end" are logged to ShitLog and skipped.
+func regionRects(pth string, regions []map[string]string) []map[string]string {
+  rects := make([]map[string]string, 0, len(regions))
+  for _, r := range regions {
+    start := stringToInt32(r["start"])
+    end := stringToInt32(r["end"])
+    if start == -2147483648 || end == -2147483648 || end < start {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v/%v: Illegal region \"%v\" to \"%v\"",pth,r["id"],r["start"],r["end"]))
+      continue
+    }
+    r["x"] = strconv.Itoa(int(start))
+    r["width"] = strconv.Itoa(int(end-start))
+    r["y"] = "0"
+    r["height"] = "1"
+    rects = append(rects, r)
+  }
+  return rects
+}
+
+// Creates and returns a new PCMAsset,
+//   errorlabel: A label used in error log entries (usually the path of the sound asset)
+//   data, freq, channels, layout: the decoded samples of the source file and their format
+//   start, end: the range of sample frames of data that make up the asset
+//   metadata: optionally a "description" (same syntax as for images) and
+//             "loopstart", "loopend" in sample frames relative to start
+func newPCMAsset(errorlabel string, data []float32, freq, channels int, layout []speaker, start, end int, metadata map[string]string) SoundAsset {
+  if start < 0 || end < start || end*channels > len(data) {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: Sample range %v-%v exceeds sound",errorlabel,start,end))
+    return nil
+  }
+  
+  meta, loopstart, loopend := soundMeta(errorlabel, metadata, freq, channels, end-start)
+  if meta == nil { return nil }
+  
+  return &PCMAsset{Data:data, Freq:freq, Channels:channels, layout:layout, Start:start, End:end, LoopStart:loopstart, LoopEnd:loopend, MetaJSON:meta}
+}
+
+// Returns the JSON metadata for a sound asset with the given sample rate, number of
+// channels and length in sample frames, whose "description", "loopstart" and "loopend"
+// are taken from metadata. Also returns the loop points (both 0 if there is no loop).
+// Returns nil if the result is not valid JSON. Errors are appended to ShitLog.
+func soundMeta(errorlabel string, metadata map[string]string, freq, channels, frames int) (meta []byte, loopstart, loopend int) {
+  loop := ""
+  loopstart, err1 := strconv.Atoi(metadata["loopstart"])
+  loopend, err2 := strconv.Atoi(metadata["loopend"])
+  if err1 == nil || err2 == nil {
+    if err1 != nil || err2 != nil || loopstart < 0 || loopend <= loopstart || loopend > frames {
+      ShitLog = append(ShitLog, fmt.Sprintf("%v: Illegal loop \"%v\" to \"%v\"",errorlabel,metadata["loopstart"],metadata["loopend"]))
+      loopstart, loopend = 0, 0
+    } else {
+      loop = fmt.Sprintf("loopstart:%v\nloopend:%v\n",loopstart,loopend)
+    }
+  } else {
+    loopstart, loopend = 0, 0
+  }
+  
+  meta = util.AlmostJSON(fmt.Sprintf("%v\n%vduration:%v\nframes:%v\nchannels:%v\nsamplerate:%v\n",metadata["description"],loop,float64(frames)/float64(freq),frames,channels,freq))
+  jsonMeta := map[string]interface{}{}
+  err := json.Unmarshal(meta, &jsonMeta)
+  if err != nil {
+    ShitLog = append(ShitLog, fmt.Sprintf("%v: JSON conversion error: %v '%v'",errorlabel,err,string(meta)))
+    return nil, 0, 0
+  }
+  return meta, loopstart, loopend
+}
+
+func (a *PCMAsset) Meta(target interface{}) error {
+  return json.Unmarshal(a.MetaJSON, target)
+}
+
+func (a *PCMAsset) metaJSON() *[]byte {
+  return &a.MetaJSON
+}
+
+func (a *PCMAsset) Samples(format SoundFormat) ([]byte,error) {
+  if !format.valid() { return nil, ErrIllFormat }
+  a.mutex.Lock()
+  defer a.mutex.Unlock()
+  if pcm, ok := a.cache[format]; ok { return pcm, nil }
+  
+  pcm := convertSamples(a.Data[a.Start*a.Channels:a.End*a.Channels], a.layout, a.Channels, a.Freq, format)
+  if a.cache == nil { a.cache = map[SoundFormat][]byte{} }
+  a.cache[format] = pcm
+  return pcm, nil
+}
@@ -0,0 +1,283 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "io"
+         "bytes"
+         
+         "github.com/jfreymuth/oggvorbis"
+         "github.com/veandco/go-sdl2/sdl"
+)
+
+// Reads the sample frames of a sound asset incrementally.
+type frameReader interface {
+  // Reads up to len(p)/channels sample frames into p and returns the number of
+  // frames read. Returns 0 at the end of the sound.
+  readFrames(p []float32) (int, error)
+  // Moves to sample frame pos, relative to the start of the asset.
+  seekFrame(pos int) error
+}
+
+// The format, length and loop points of a sound asset.
+type streamInfo struct {
+  freq, channels int
+  layout []speaker
+  frames int
+  loopStart, loopEnd int
+}
+
+// Sound assets that can be read by a SoundStream.
+type streamable interface {
+  // Returns a new frameReader positioned at the start of the asset.
+  openStream() (frameReader, streamInfo, error)
+}
+
+type pcmReader struct {
+  a *PCMAsset
+  pos int
+}
+
+func (r *pcmReader) readFrames(p []float32) (int, error) {
+  ch := r.a.Channels
+  n := copy(p, r.a.Data[(r.a.Start+r.pos)*ch:r.a.End*ch])/ch
+  r.pos += n
+  return n, nil
+}
+
+func (r *pcmReader) seekFrame(pos int) error {
+  r.pos = pos
+  return nil
+}
+
+func (a *PCMAsset) openStream() (frameReader, streamInfo, error) {
+  return &pcmReader{a:a}, streamInfo{a.Freq, a.Channels, a.layout, a.End-a.Start, a.LoopStart, a.LoopEnd}, nil
+}
+
+type vorbisReader struct {
+  a *VorbisAsset
+  r *oggvorbis.Reader
+  pos int
+}
+
+func (r *vorbisReader) readFrames(p []float32) (int, error) {
+  ch := r.a.Channels
+  max := (r.a.End-r.a.Start-r.pos)*ch
+  if len(p) > max { p = p[0:max] }
+  if len(p) < ch { return 0, nil }
+  n, err := r.r.Read(p)
+  if err == io.EOF { err = nil }
+  r.pos += n/ch
+  return n/ch, err
+}
+
+func (r *vorbisReader) seekFrame(pos int) error {
+  r.pos = pos
+  return r.r.SetPosition(int64(r.a.Start+pos))
+}
+
+func (a *VorbisAsset) openStream() (frameReader, streamInfo, error) {
+  info := streamInfo{a.Freq, a.Channels, a.layout, a.End-a.Start, a.LoopStart, a.LoopEnd}
+  r, err := oggvorbis.NewReader(bytes.NewReader(a.Data))
+  if err != nil { return nil, info, err }
+  vr := &vorbisReader{a:a, r:r}
+  return vr, info, vr.seekFrame(0)
+}
+
+// Number of source sample frames a SoundStream decodes at once.
+const streamChunk = 4096
+
+// Reads a sound asset incrementally and converts it to a SoundFormat on the fly.
+// This is meant for long sounds such as music, especially those stored as
+// VorbisAssets, which are only decoded as far as they have been read.
+// A SoundStream must not be used by multiple goroutines at the same time.
+type SoundStream struct {
+  // If true, reading continues at the asset's loop start when its loop end is
+  // reached. If the asset has no loop points, the whole sound is repeated.
+  // Initialized to true if the asset has loop points.
+  Loop bool
+  
+  src frameReader
+  info streamInfo
+  format SoundFormat
+  
+  // The next frame read from src (relative to the start of the asset).
+  pos int
+  // true when src has been read completely (and Loop is false).
+  eof bool
+  // The first error returned by src.
+  err error
+  
+  // Frames read from src and mixed to format.Channels, but not yet (completely)
+  // consumed by the resampler.
+  inbuf []float32
+  // The position of the next output frame in inbuf (in input sample frames).
+  t float64
+  
+  // Resampling filter. nil if src has the target sample rate.
+  table []float32
+  halfwidth float64
+  
+  // buffer for reading from src
+  tmp []float32
+}
+
+// Returns a SoundStream that reads the asset a converted to format.
+func newSoundStream(a streamable, format SoundFormat) (*SoundStream, error) {
+  if !format.valid() { return nil, ErrIllFormat }
+  src, info, err := a.openStream()
+  if err != nil { return nil, err }
+  s := &SoundStream{Loop:info.loopEnd > info.loopStart, src:src, info:info, format:format}
+  if info.freq != format.Freq {
+    s.table, s.halfwidth = sincTable(info.freq, format.Freq)
+  }
+  return s, nil
+}
+
+// Moves the stream to sample frame pos (in the asset's original sample rate,
+// relative to the asset's start).
+func (s *SoundStream) SeekFrame(pos int) error {
+  if pos < 0 { pos = 0 }
+  if pos > s.info.frames { pos = s.info.frames }
+  s.inbuf = s.inbuf[0:0]
+  s.t = 0
+  s.eof = false
+  s.pos = pos
+  s.err = s.src.seekFrame(pos)
+  return s.err
+}
+
+// Reads up to streamChunk frames from src into inbuf. Handles looping.
+func (s *SoundStream) fill() {
+  end := s.info.frames
+  start := 0
+  if s.Loop && s.info.loopEnd > s.info.loopStart {
+    end = s.info.loopEnd
+    start = s.info.loopStart
+  }
+  if s.pos >= end {
+    if !s.Loop || end <= start {
+      s.eof = true
+      return
+    }
+    s.err = s.src.seekFrame(start)
+    s.pos = start
+  }
+  
+  frames := end-s.pos
+  if frames > streamChunk { frames = streamChunk }
+  if cap(s.tmp) < frames*s.info.channels { s.tmp = make([]float32, frames*s.info.channels) }
+  n, err := s.src.readFrames(s.tmp[0:frames*s.info.channels])
+  if err != nil && s.err == nil { s.err = err }
+  if n == 0 || s.err != nil {
+    s.eof = true
+    return
+  }
+  s.pos += n
+  s.inbuf = append(s.inbuf, mixChannels(s.tmp[0:n*s.info.channels], s.info.layout, s.info.channels, s.format.Channels)...)
+}
+
+// Stores up to len(out)/format.Channels converted frames in out. Returns the number
+// of frames stored, which is less than requested only at the end of the stream.
+func (s *SoundStream) readConverted(out []float32) int {
+  ch := s.format.Channels
+  frames := len(out)/ch
+  n := 0
+  
+  if s.table == nil { // no resampling necessary
+    for n < frames {
+      if len(s.inbuf) == 0 {
+        if s.eof { break }
+        s.fill()
+        continue
+      }
+      k := copy(out[n*ch:frames*ch], s.inbuf)
+      s.inbuf = s.inbuf[k:]
+      n += k/ch
+    }
+    return n
+  }
+  
+  step := float64(s.info.freq)/float64(s.format.Freq)
+  for n < frames {
+    // the filter needs the frames up to t+halfwidth
+    for !s.eof && len(s.inbuf)/ch <= int(s.t+s.halfwidth) { s.fill() }
+    if s.eof && s.t >= float64(len(s.inbuf)/ch) { break }
+    sincFrame(out[n*ch:(n+1)*ch], s.inbuf, s.t, s.table, s.halfwidth)
+    n++
+    s.t += step
+    
+    // discard frames that are no longer needed
+    if drop := int(s.t-s.halfwidth); drop >= streamChunk {
+      s.inbuf = append(s.inbuf[0:0], s.inbuf[drop*ch:]...)
+      s.t -= float64(drop)
+    }
+  }
+  return n
+}
+
+// Reads converted PCM data (as returned by Sound()) into p. Only whole sample frames
+// are read. Returns io.EOF after the end of the sound (never if Loop is true, unless
+// the sound is empty).
+func (s *SoundStream) Read(p []byte) (int, error) {
+  fs := s.format.frameSize()
+  frames := len(p)/fs
+  if frames == 0 { return 0, nil }
+  out := make([]float32, frames*s.format.Channels)
+  n := s.readConverted(out)
+  putSamples(p, out[0:n*s.format.Channels], s.format.Type)
+  if n == 0 {
+    if s.err != nil { return 0, s.err }
+    return 0, io.EOF
+  }
+  return n*fs, nil
+}
+
+// Fills p completely with converted PCM data. After the end of the sound p is filled
+// with silence. This is meant to be called from an SDL audio callback.
+// Returns false if p contains only silence because the end has been reached before.
+func (s *SoundStream) Fill(p []byte) bool {
+  n := 0
+  for n < len(p) {
+    k, err := s.Read(p[n:])
+    n += k
+    if err != nil || k == 0 { break }
+  }
+  for i := n; i < len(p); i++ { p[i] = 0 }
+  return n > 0
+}
+
+// Queues converted PCM data on the SDL audio device dev (which must have been opened
+// with the stream's format and without callback) so that at least ahead bytes are
+// queued. Call this regularly, e.g. once per frame. Returns io.EOF once the end
+// of the sound has been queued.
+func (s *SoundStream) Queue(dev sdl.AudioDeviceID, ahead int) error {
+  queued := int(sdl.GetQueuedAudioSize(dev))
+  if queued >= ahead { return nil }
+  p := make([]byte, ahead-queued)
+  n, err := s.Read(p)
+  if n > 0 {
+    if qerr := sdl.QueueAudio(dev, p[0:n]); qerr != nil { return qerr }
+  }
+  return err
+}
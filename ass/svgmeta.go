@@ -0,0 +1,114 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "io"
+         "fmt"
+         "sort"
+         "strings"
+         "encoding/xml"
+         "encoding/json"
+)
+
+// The metadata keys taken from the document metadata of SVG files (see svgDocumentMeta()).
+var documentMetaKeys = map[string]bool{
+  "title":true, "description":true, "creator":true, "rights":true, "publisher":true,
+  "contributor":true, "date":true, "source":true, "language":true, "identifier":true,
+  "relation":true, "coverage":true, "keywords":true, "license":true,
+}
+
+// Takes the source code of the <title>, <desc> and <metadata> children of an SVG
+// file's <svg> element and returns the information they contain in the syntax of
+// descriptions. The <metadata> element is expected to contain RDF as written by
+// Inkscape's Document Metadata dialog. The Dublin Core elements become the keys
+// of documentMetaKeys with the same names ("subject" becomes "keywords", an array)
+// and the URL of the Creative Commons license becomes "license". <title> and <desc>
+// take precedence over dc:title and dc:description.
+// Errors are appended to ShitLog.
+func svgDocumentMeta(pth string, docparts []string) string {
+  meta := map[string]interface{}{}
+  for _, part := range docparts {
+    dec := xml.NewDecoder(strings.NewReader(part))
+    dec.Strict = false
+    
+    // local names of the enclosing elements
+    stack := []string{}
+    // the element below cc:Work (or the root element) that text belongs to
+    key := ""
+    text := ""
+    for {
+      tok, err := dec.Token()
+      if err != nil {
+        if err != io.EOF {
+          ShitLog = append(ShitLog, fmt.Sprintf("%v: Document metadata: %v",pth,err))
+        }
+        break
+      }
+      switch t := tok.(type) {
+        case xml.StartElement:
+          stack = append(stack, t.Name.Local)
+          if len(stack) == 1 && t.Name.Local != "metadata" {
+            key, text = t.Name.Local, ""
+          } else if len(stack) >= 2 && stack[len(stack)-2] == "Work" {
+            key, text = t.Name.Local, ""
+            if key == "license" {
+              for _, attr := range t.Attr {
+                if attr.Name.Local == "resource" { meta["license"] = attr.Value }
+              }
+            }
+          }
+          if key == "subject" && t.Name.Local == "li" { text = "" }
+        case xml.CharData:
+          text += string(t)
+        case xml.EndElement:
+          local := stack[len(stack)-1]
+          stack = stack[0:len(stack)-1]
+          text = strings.TrimSpace(text)
+          if key == "subject" && local == "li" && text != "" {
+            keywords, _ := meta["keywords"].([]string)
+            meta["keywords"] = append(keywords, text)
+          } else if local == key && text != "" {
+            switch {
+              case key == "title" && len(stack) == 0: meta["title"] = text // <title> wins over dc:title
+              case key == "desc": meta["description"] = text
+              case key == "description" && meta["description"] == nil: meta["description"] = text
+              case key == "title" && meta["title"] == nil: meta["title"] = text
+              case key != "title" && key != "description" && documentMetaKeys[key]: meta[key] = text
+            }
+          }
+          if local == key { key = "" }
+      }
+    }
+  }
+  
+  keys := make([]string, 0, len(meta))
+  for k := range meta { keys = append(keys, k) }
+  sort.Strings(keys)
+  desc := ""
+  for _, k := range keys {
+    value, _ := json.Marshal(meta[k])
+    desc += fmt.Sprintf("%q:%s\n", k, value)
+  }
+  return desc
+}
@@ -0,0 +1,209 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Manages graphics and sound assets.
+package ass
+
+import (
+         "fmt"
+         "math"
+         "sort"
+         "errors"
+         "strconv"
+         "encoding/binary"
+)
+
+var errNotWAV = errors.New("not a RIFF WAVE file")
+var errWAVFormat = errors.New("unsupported WAVE format")
+
+// Information from a WAV file besides the samples.
+type wavInfo struct {
+  // The WAVE_FORMAT_EXTENSIBLE channel mask. 0 if not present.
+  mask uint32
+  
+  // One map per labeled cue point with the keys "id" (the label), "start" and "end"
+  // (in sample frames, end is exclusive), i.e. in the format returned by parseSidecar()
+  // with soundSidecarKeys.
+  regions []map[string]string
+  
+  // The first loop from the "smpl" chunk. loopEnd is exclusive. Both are 0 if
+  // there is no loop.
+  loopStart, loopEnd int
+  
+  // Problems with the file that do not prevent decoding it, e.g. a truncated
+  // "cue " chunk.
+  warnings []string
+}
+
+// Decodes the RIFF WAVE file data. Supports integer PCM with 8, 16, 24 or 32 bits
+// per sample and IEEE floating point with 32 or 64 bits per sample (also in the
+// WAVE_FORMAT_EXTENSIBLE variant). Returns the interleaved samples in the range
+// -1.0 to 1.0, the sample rate, the number of channels and further information
+// such as the regions defined by the "cue " chunk and "labl"/"ltxt" entries of a
+// "LIST" chunk of type "adtl".
+// A cue point without "ltxt" length extends to the next cue point.
+func decodeWAV(data []byte) (samples []float32, freq int, channels int, info wavInfo, err error) {
+  if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+    err = errNotWAV
+    return
+  }
+  
+  var format, bits int
+  var pcm []byte
+  
+  // cue point id => position in sample frames
+  cues := map[uint32]int{}
+  // cue point id => label
+  labels := map[uint32]string{}
+  // cue point id => length in sample frames
+  lengths := map[uint32]int{}
+  
+  for chunk := data[12:]; len(chunk) >= 8; {
+    id := string(chunk[0:4])
+    size := int(binary.LittleEndian.Uint32(chunk[4:8]))
+    rest := chunk[8:]
+    if size > len(rest) { size = len(rest) } // truncated file => use what's there
+    body := rest[0:size]
+    
+    switch id {
+      case "fmt ":
+        if size < 16 {
+          err = errWAVFormat
+          return
+        }
+        format = int(binary.LittleEndian.Uint16(body[0:2]))
+        channels = int(binary.LittleEndian.Uint16(body[2:4]))
+        freq = int(binary.LittleEndian.Uint32(body[4:8]))
+        bits = int(binary.LittleEndian.Uint16(body[14:16]))
+        if format == 0xfffe && size >= 26 { // WAVE_FORMAT_EXTENSIBLE => use SubFormat GUID
+          info.mask = binary.LittleEndian.Uint32(body[20:24])
+          format = int(binary.LittleEndian.Uint16(body[24:26]))
+        }
+      case "data":
+        pcm = body
+      case "cue ":
+        if size < 4 {
+          info.warnings = append(info.warnings, "Truncated cue chunk")
+          break
+        }
+        if n := int64(binary.LittleEndian.Uint32(body[0:4])); n*24 != int64(size-4) {
+          info.warnings = append(info.warnings, fmt.Sprintf("cue chunk declares %v cue points but has room for %v",n,(size-4)/24))
+        }
+        for c := body[4:]; len(c) >= 24; c = c[24:] {
+          cues[binary.LittleEndian.Uint32(c[0:4])] = int(binary.LittleEndian.Uint32(c[20:24]))
+        }
+      case "LIST":
+        if size < 4 || string(body[0:4]) != "adtl" { break }
+        for sub := body[4:]; len(sub) >= 12; {
+          subsize := int(binary.LittleEndian.Uint32(sub[4:8]))
+          if subsize > len(sub)-8 { subsize = len(sub)-8 }
+          subbody := sub[8:8+subsize]
+          var cueid uint32
+          if subsize >= 4 { cueid = binary.LittleEndian.Uint32(subbody[0:4]) }
+          switch string(sub[0:4]) {
+            case "labl":
+              if subsize < 4 { break }
+              label := subbody[4:]
+              for i := range label {
+                if label[i] == 0 { label = label[0:i]; break }
+              }
+              labels[cueid] = string(label)
+            case "ltxt":
+              if subsize >= 8 { lengths[cueid] = int(binary.LittleEndian.Uint32(subbody[4:8])) }
+          }
+          sub = sub[8+subsize:]
+          if subsize&1 != 0 && len(sub) > 0 { sub = sub[1:] }
+        }
+      case "smpl":
+        if size >= 36+24 && binary.LittleEndian.Uint32(body[28:32]) > 0 {
+          info.loopStart = int(binary.LittleEndian.Uint32(body[36+8:36+12]))
+          info.loopEnd = int(binary.LittleEndian.Uint32(body[36+12:36+16]))+1 // smpl end is inclusive
+        }
+    }
+    
+    // chunks are padded to even size
+    chunk = rest[size:]
+    if size&1 != 0 && len(chunk) > 0 { chunk = chunk[1:] }
+  }
+  
+  if pcm == nil || channels <= 0 {
+    err = errNotWAV
+    return
+  }
+  
+  bytes := bits/8
+  if bits&7 != 0 || bytes == 0 {
+    err = errWAVFormat
+    return
+  }
+  n := len(pcm)/bytes
+  n -= n % channels
+  samples = make([]float32, n)
+  
+  switch {
+    case format == 1 && bits == 8: // unsigned!
+      for i := range samples { samples[i] = float32(int(pcm[i])-128)/128 }
+    case format == 1 && bits == 16:
+      for i := range samples { samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[i*2:])))/32768 }
+    case format == 1 && bits == 24:
+      for i := range samples {
+        p := pcm[i*3:]
+        samples[i] = float32(int32(uint32(p[0])<<8 | uint32(p[1])<<16 | uint32(p[2])<<24)>>8)/8388608
+      }
+    case format == 1 && bits == 32:
+      for i := range samples { samples[i] = float32(float64(int32(binary.LittleEndian.Uint32(pcm[i*4:])))/2147483648) }
+    case format == 3 && bits == 32:
+      for i := range samples { samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(pcm[i*4:])) }
+    case format == 3 && bits == 64:
+      for i := range samples { samples[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(pcm[i*8:]))) }
+    default:
+      err = errWAVFormat
+      return
+  }
+  
+  // sort cue point positions to find the end of cue points without length
+  frames := n/channels
+  positions := make([]int, 0, len(cues)+1)
+  for _, pos := range cues { positions = append(positions, pos) }
+  positions = append(positions, frames)
+  sort.Ints(positions)
+  
+  // by position (and id), so that the order of the regions does not depend on map order
+  ids := make([]uint32, 0, len(cues))
+  for cueid := range cues { ids = append(ids, cueid) }
+  sort.Slice(ids, func(i, j int) bool { return cues[ids[i]] < cues[ids[j]] || (cues[ids[i]] == cues[ids[j]] && ids[i] < ids[j]) })
+  
+  for _, cueid := range ids {
+    start := cues[cueid]
+    label := labels[cueid]
+    if label == "" || start >= frames { continue } // unlabeled cue points do not define assets
+    end, ok := lengths[cueid]
+    if ok {
+      end += start
+    } else {
+      end = positions[sort.SearchInts(positions, start+1)]
+    }
+    if end > frames { end = frames }
+    info.regions = append(info.regions, map[string]string{"id":label, "start":strconv.Itoa(start), "end":strconv.Itoa(end)})
+  }
+  
+  return
+}
@@ -0,0 +1,223 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Generates a Go source file with typed asset paths and metadata structs for all
+// assets found in the directories given on the command line (default: the current
+// directory), so that references to missing assets become compile errors.
+// Intended for use with go generate, e.g.
+//   //go:generate go run ../assgen/assgen.go -pkg assets -o assets.go ../gfx ../sfx
+package main
+
+import (
+  "os"
+  "fmt"
+  "flag"
+  "math"
+  "sort"
+  "bytes"
+  "strings"
+  "strconv"
+  "unicode"
+  "io/ioutil"
+  "go/format"
+  
+  "../ass"
+)
+
+// A node of the asset tree.
+type node struct {
+  // The asset path. "" for the root.
+  path string
+  // true if there is an asset at path (not only sub-assets).
+  asset bool
+  sub map[string]*node
+}
+
+func main() {
+  pkg := flag.String("pkg", "assets", "package name of the generated file")
+  out := flag.String("o", "", "output file (default: stdout)")
+  inherit := flag.Bool("inherit", false, "infer metadata types with ass.InheritMeta set")
+  flag.Parse()
+  
+  ass.InheritMeta = *inherit
+  dirs := flag.Args()
+  if len(dirs) == 0 { dirs = []string{"."} }
+  for _, dir := range dirs {
+    err := ass.Add(dir)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(2)
+    }
+  }
+  if len(ass.ShitLog) > 0 {
+    fmt.Fprintln(os.Stderr, strings.Join(ass.ShitLog,"\n"))
+  }
+  
+  root := &node{sub:map[string]*node{}}
+  for _, pth := range ass.List("/") {
+    n := root
+    for _, k := range strings.Split(pth, "/") {
+      if n.sub[k] == nil { n.sub[k] = &node{path:strings.TrimPrefix(n.path+"/"+k, "/"), sub:map[string]*node{}} }
+      n = n.sub[k]
+    }
+    n.asset = true
+  }
+  
+  g := &generator{names:map[string]bool{}}
+  fmt.Fprintf(&g.buf, "// Code generated by assgen from %v. DO NOT EDIT.\n\npackage %v\n", strings.Join(dirs, ", "), *pkg)
+  vars := &bytes.Buffer{}
+  for _, k := range root.keys() {
+    n := root.sub[k]
+    name := unique(identifier(k), g.names)
+    _, value := g.value(n, name)
+    fmt.Fprintf(vars, "\n// The asset tree at %q.\nvar %v = %v\n", n.path, name, value)
+  }
+  g.buf.Write(vars.Bytes())
+  
+  src, err := format.Source(g.buf.Bytes())
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(2)
+  }
+  if *out == "" {
+    os.Stdout.Write(src)
+  } else if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(2)
+  }
+}
+
+type generator struct {
+  // The type declarations generated so far.
+  buf bytes.Buffer
+  // The package-level identifiers (types and vars) used so far.
+  names map[string]bool
+}
+
+// Declares a struct type for n (named after name, the identifier for n.path)
+// with a Path field if n is an asset and a field for each sub-node. If n is an
+// asset, a struct type for its metadata is declared, too.
+// Returns the type name and a composite literal of that type for n.
+func (g *generator) value(n *node, name string) (typ string, value string) {
+  typ = unique(lower(name)+"Assets", g.names)
+  var fields, values []string
+  used := map[string]bool{}
+  if n.asset {
+    used["Path"] = true
+    meta := unique(name+"Meta", g.names)
+    fields = append(fields, fmt.Sprintf("// The asset path. Its metadata can be read with ass.Meta() into a %v.\nPath string", meta))
+    values = append(values, fmt.Sprintf("Path: %q", n.path))
+    fmt.Fprintf(&g.buf, "\n// The metadata of %q.\ntype %v %v\n", n.path, meta, g.metaType(n.path))
+  }
+  for _, k := range n.keys() {
+    field := unique(identifier(k), used)
+    subtyp, subvalue := g.value(n.sub[k], name+field)
+    fields = append(fields, fmt.Sprintf("%v %v", field, subtyp))
+    values = append(values, fmt.Sprintf("%v: %v", field, subvalue))
+  }
+  fmt.Fprintf(&g.buf, "\n// The asset tree at %q.\ntype %v struct {\n%v\n}\n", n.path, typ, strings.Join(fields, "\n"))
+  if len(values) == 0 { return typ, typ+"{}" }
+  return typ, typ+"{\n"+strings.Join(values, ",\n")+",\n}"
+}
+
+// Returns a struct type for the metadata of the asset pth.
+func (g *generator) metaType(pth string) string {
+  meta := map[string]interface{}{}
+  err := ass.Meta(pth, &meta)
+  if err != nil { fmt.Fprintf(os.Stderr, "%v: %v\n", pth, err) }
+  return typeOf(meta)
+}
+
+// Returns the Go type for the JSON value v. Numbers without fraction become int.
+// Objects become structs.
+func typeOf(v interface{}) string {
+  switch v := v.(type) {
+    case bool: return "bool"
+    case string: return "string"
+    case float64:
+      if v == math.Trunc(v) && math.Abs(v) < 1<<53 { return "int" }
+      return "float64"
+    case []interface{}:
+      elem := ""
+      for _, e := range v {
+        t := typeOf(e)
+        if elem == "" || elem == t {
+          elem = t
+        } else if (elem == "int" || elem == "float64") && (t == "int" || t == "float64") {
+          elem = "float64"
+        } else {
+          elem = "interface{}"
+        }
+      }
+      if elem == "" { elem = "interface{}" }
+      return "[]"+elem
+    case map[string]interface{}:
+      var fields []string
+      used := map[string]bool{}
+      for _, k := range sortedKeys(v) {
+        fields = append(fields, fmt.Sprintf("%v %v `json:%q`", unique(identifier(k), used), typeOf(v[k]), k))
+      }
+      return "struct {\n"+strings.Join(fields, "\n")+"\n}"
+  }
+  return "interface{}"
+}
+
+// Returns s converted to an exported Go identifier, e.g. "big-car" => "BigCar".
+func identifier(s string) string {
+  id := ""
+  for _, part := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+    r := []rune(part)
+    id += string(unicode.ToUpper(r[0]))+string(r[1:])
+  }
+  if r := []rune(id); len(r) == 0 || !unicode.IsUpper(r[0]) { id = "X"+id }
+  return id
+}
+
+// Returns name with its first letter converted to lower case.
+func lower(name string) string {
+  r := []rune(name)
+  return string(unicode.ToLower(r[0]))+string(r[1:])
+}
+
+// Returns name, or if that is in used, name with the lowest number >= 2 appended
+// that is not in used. Adds the result to used.
+func unique(name string, used map[string]bool) string {
+  res := name
+  for i := 2; used[res]; i++ { res = name+strconv.Itoa(i) }
+  used[res] = true
+  return res
+}
+
+// Returns the names of the sub-nodes of n in sorted order.
+func (n *node) keys() []string {
+  keys := make([]string, 0, len(n.sub))
+  for k := range n.sub { keys = append(keys, k) }
+  sort.Strings(keys)
+  return keys
+}
+
+// Returns the keys of m in sorted order.
+func sortedKeys(m map[string]interface{}) []string {
+  keys := make([]string, 0, len(m))
+  for k := range m { keys = append(keys, k) }
+  sort.Strings(keys)
+  return keys
+}
@@ -0,0 +1,65 @@
+/* Copyright (C) 2017 Matthias S. Benkmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this file (originally named buttons.go) and associated documentation files 
+ * (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is furnished
+ * to do so, subject to the following conditions:
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ * 
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE. 
+ */
+
+// Writes a license and attribution report of all assets found in the directories
+// given on the command line (default: the current directory).
+package main
+
+import (
+  "os"
+  "fmt"
+  "flag"
+  "strings"
+  
+  "../ass"
+)
+
+func main() {
+  format := flag.String("format", "text", "report format: text, json or csv")
+  strict := flag.Bool("strict", false, "exit with status 1 if an asset has no license")
+  flag.Parse()
+  
+  dirs := flag.Args()
+  if len(dirs) == 0 { dirs = []string{"."} }
+  for _, dir := range dirs {
+    err := ass.Add(dir)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(2)
+    }
+  }
+  if len(ass.ShitLog) > 0 {
+    fmt.Fprintln(os.Stderr, strings.Join(ass.ShitLog,"\n"))
+  }
+  
+  groups := ass.Audit()
+  err := ass.WriteAudit(os.Stdout, groups, *format)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(2)
+  }
+  
+  if *strict {
+    for _, g := range groups {
+      if g.License == "" { os.Exit(1) }
+    }
+  }
+}
@@ -41,6 +41,10 @@ func main() {
     var meta map[string]interface{}
     err := ass.Meta(a,&meta)
     if err != nil { panic(err) }
+    if meta["width"] == nil { // not an image
+      fmt.Printf("-> %v (%v)\n",a,meta)
+      continue
+    }
     var width, height int = int(meta["width"].(float64)), int(meta["height"].(float64))
     img, err := ass.Image(a, width, height)
     if err != nil { panic(err) }